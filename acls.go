@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+// everyACL is a describe filter matching every ACL of the cluster.
+func everyACL() *kadm.ACLBuilder {
+	return kadm.NewACLs().
+		AnyResource().
+		ResourcePatternType(kadm.ACLPatternAny).
+		Allow().AllowHosts().
+		Deny().DenyHosts().
+		Operations(kadm.OpAny)
+}
+
+type aclKey struct {
+	resourceType string
+	principal    string
+	operation    string
+	permission   string
+}
+
+// exportACLs exports the number of ACLs per resource type, principal,
+// operation and permission type. Resource names are left out on purpose, so
+// that clusters with an ACL per topic don't explode the cardinality.
+func (e *exporter) exportACLs(ctx context.Context) error {
+	results, err := e.client.DescribeACLs(ctx, everyACL())
+	switch {
+	case err == nil:
+	case unsupported(err):
+		log.Debug().Err(err).Msg("cluster does not support describe acls, skipping acl metrics")
+		return nil
+	default:
+		return err
+	}
+
+	counts := make(map[aclKey]int)
+	for _, result := range results {
+		if errors.Is(result.Err, kerr.SecurityDisabled) {
+			log.Debug().Err(result.Err).Msg("cluster has no authorizer configured, skipping acl metrics")
+			return nil
+		}
+		if result.Err != nil {
+			log.Error().Err(result.Err).Msg("failed to describe acls")
+			e.onErrors.Record(result.Err)
+			continue
+		}
+
+		for _, acl := range result.Described {
+			counts[aclKey{
+				resourceType: acl.Type.String(),
+				principal:    acl.Principal,
+				operation:    acl.Operation.String(),
+				permission:   acl.Permission.String(),
+			}]++
+		}
+	}
+
+	e.metrics.acl.acls.Reset()
+	for key, count := range counts {
+		e.metrics.acl.acls.With(prometheus.Labels{
+			"resource_type": key.resourceType,
+			"principal":     key.principal,
+			"operation":     key.operation,
+			"permission":    key.permission,
+		}).Set(float64(count))
+	}
+
+	return nil
+}
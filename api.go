@@ -0,0 +1,218 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// snapshot is the state of the cluster seen by an export cycle, served as JSON
+// on /api/v1.
+type snapshot struct {
+	cluster clusterSnapshot
+	topics  map[string]topicSnapshot
+	// groups is nil unless the groups were exported by the cycle
+	groups map[string]groupSnapshot
+}
+
+type clusterSnapshot struct {
+	ID         string           `json:"id"`
+	Controller int32            `json:"controller"`
+	Brokers    []brokerSnapshot `json:"brokers"`
+	Topics     int              `json:"topics"`
+	Groups     int              `json:"groups"`
+	UpdatedAt  time.Time        `json:"updated_at"`
+}
+
+type brokerSnapshot struct {
+	ID   int32   `json:"id"`
+	Host string  `json:"host"`
+	Port int32   `json:"port"`
+	Rack *string `json:"rack,omitempty"`
+}
+
+type topicSnapshot struct {
+	Name       string              `json:"name"`
+	Partitions []partitionSnapshot `json:"partitions"`
+	UpdatedAt  time.Time           `json:"updated_at"`
+}
+
+type partitionSnapshot struct {
+	Partition    int32   `json:"partition"`
+	Leader       int32   `json:"leader"`
+	Replicas     []int32 `json:"replicas"`
+	ISR          []int32 `json:"isr"`
+	OldestOffset *int64  `json:"oldest_offset,omitempty"`
+	EndOffset    *int64  `json:"end_offset,omitempty"`
+	Error        string  `json:"error,omitempty"`
+}
+
+type groupSnapshot struct {
+	Name        string                   `json:"name"`
+	State       string                   `json:"state"`
+	Status      string                   `json:"status"`
+	Coordinator int32                    `json:"coordinator"`
+	Members     []memberSnapshot         `json:"members"`
+	Lag         int64                    `json:"lag"`
+	Partitions  []groupPartitionSnapshot `json:"partitions"`
+	UpdatedAt   time.Time                `json:"updated_at"`
+}
+
+type memberSnapshot struct {
+	ID         string  `json:"id"`
+	InstanceID *string `json:"instance_id,omitempty"`
+	ClientID   string  `json:"client_id"`
+	Host       string  `json:"host"`
+}
+
+type groupPartitionSnapshot struct {
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Offset is nil if the group has no committed offset for the partition
+	Offset    *int64 `json:"offset,omitempty"`
+	EndOffset int64  `json:"end_offset"`
+	Lag       int64  `json:"lag"`
+	Member    string `json:"member,omitempty"`
+}
+
+func newSnapshot(metadata kadm.Metadata, startOffsets, endOffsets kadm.ListedOffsets, at time.Time) *snapshot {
+	s := &snapshot{
+		cluster: clusterSnapshot{
+			ID:         metadata.Cluster,
+			Controller: metadata.Controller,
+			Topics:     len(metadata.Topics),
+			UpdatedAt:  at,
+		},
+		topics: make(map[string]topicSnapshot, len(metadata.Topics)),
+	}
+
+	for _, broker := range metadata.Brokers {
+		s.cluster.Brokers = append(s.cluster.Brokers, brokerSnapshot{
+			ID:   broker.NodeID,
+			Host: broker.Host,
+			Port: broker.Port,
+			Rack: broker.Rack,
+		})
+	}
+
+	offset := func(offsets kadm.ListedOffsets, topic string, partition int32) *int64 {
+		if o, ok := offsets.Lookup(topic, partition); ok && o.Err == nil {
+			return &o.Offset
+		}
+		return nil
+	}
+
+	for _, topic := range metadata.Topics.Sorted() {
+		t := topicSnapshot{Name: topic.Topic, Partitions: []partitionSnapshot{}, UpdatedAt: at}
+		for _, partition := range topic.Partitions.Sorted() {
+			p := partitionSnapshot{
+				Partition:    partition.Partition,
+				Leader:       partition.Leader,
+				Replicas:     partition.Replicas,
+				ISR:          partition.ISR,
+				OldestOffset: offset(startOffsets, topic.Topic, partition.Partition),
+				EndOffset:    offset(endOffsets, topic.Topic, partition.Partition),
+			}
+			if partition.Err != nil {
+				p.Error = partition.Err.Error()
+			}
+			t.Partitions = append(t.Partitions, p)
+		}
+		s.topics[topic.Topic] = t
+	}
+
+	return s
+}
+
+// storeSnapshot makes the snapshot of an export cycle the one served, keeping
+// the groups of the previous one if the cycle didn't export them. Only cycles
+// that exported the groups add to their lag history.
+func (e *exporter) storeSnapshot(s *snapshot) {
+	exported := s.groups != nil
+	if !exported {
+		if previous := e.snapshot.Load(); previous != nil {
+			s.groups = previous.groups
+		}
+	}
+	s.cluster.Groups = len(s.groups)
+	e.snapshot.Store(s)
+	if exported {
+		e.history.record(s.groups)
+	}
+}
+
+// apiHandler serves the latest snapshot as JSON.
+func (e *exporter) apiHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /api/v1/clusters", e.serveSnapshot(func(s *snapshot, _ *http.Request) (any, bool) {
+		return []clusterSnapshot{s.cluster}, true
+	}))
+	mux.HandleFunc("GET /api/v1/topics", e.serveSnapshot(func(s *snapshot, _ *http.Request) (any, bool) {
+		return sortedValues(s.topics), true
+	}))
+	mux.HandleFunc("GET /api/v1/topics/{topic}", e.serveSnapshot(func(s *snapshot, r *http.Request) (any, bool) {
+		topic, ok := s.topics[r.PathValue("topic")]
+		return topic, ok
+	}))
+	mux.HandleFunc("GET /api/v1/groups", e.serveSnapshot(func(s *snapshot, _ *http.Request) (any, bool) {
+		return sortedValues(s.groups), true
+	}))
+	mux.HandleFunc("GET /api/v1/groups/{group}", e.serveSnapshot(func(s *snapshot, r *http.Request) (any, bool) {
+		group, ok := s.groups[r.PathValue("group")]
+		return group, ok
+	}))
+
+	return mux
+}
+
+// serveSnapshot serves what get picks out of the latest snapshot, 404 if it
+// isn't there, 503 until the first export cycle completes.
+func (e *exporter) serveSnapshot(get func(*snapshot, *http.Request) (any, bool)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s := e.snapshot.Load()
+		if s == nil {
+			writeJSON(w, http.StatusServiceUnavailable, apiError{"no export cycle completed yet"})
+			return
+		}
+
+		v, ok := get(s, r)
+		if !ok {
+			writeJSON(w, http.StatusNotFound, apiError{"not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Debug().Err(err).Msg("failed to write api response")
+	}
+}
+
+// sortedValues returns the values of m sorted by key, an empty slice rather
+// than nil so that it's encoded as [].
+func sortedValues[V any](m map[string]V) []V {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	values := make([]V, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, m[k])
+	}
+	return values
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/phuslu/log"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/plugin/kphuslog"
+)
+
+func TestAPI(t *testing.T) {
+	_, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+
+	client, err := kgo.NewClient(append(
+		testOpts(t, conf),
+		kgo.ConsumerGroup("billing"),
+		kgo.ConsumeTopics("orders"),
+		kgo.WithLogger(kphuslog.New(&log.Logger{Level: log.ErrorLevel})),
+	)...)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	api := e.apiHandler()
+	get := func(path string, v any) int {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if v != nil && w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+				t.Fatal(err, "failed to decode", path)
+			}
+		}
+		return w.Code
+	}
+
+	if code := get("/api/v1/topics", nil); code != http.StatusServiceUnavailable {
+		t.Error("expected 503 before the first export cycle, got", code)
+	}
+
+	for _, value := range []string{"a", "b", "c"} {
+		if err := client.ProduceSync(ctx, &kgo.Record{Topic: "orders", Value: []byte(value)}).FirstErr(); err != nil {
+			t.Fatal(err, "failed to produce")
+		}
+	}
+
+	fetches := client.PollRecords(ctx, 1)
+	if err := fetches.Err(); err != nil {
+		t.Fatal(err, "failed to poll")
+	}
+	if err := client.CommitRecords(ctx, fetches.Records()...); err != nil {
+		t.Fatal(err, "failed to commit")
+	}
+
+	if err := e.export(ctx); err != nil {
+		t.Fatal(err, "failed to export")
+	}
+
+	var clusters []clusterSnapshot
+	if code := get("/api/v1/clusters", &clusters); code != http.StatusOK {
+		t.Fatal("expected 200, got", code)
+	}
+	if len(clusters) != 1 || clusters[0].ID != "kfake" || len(clusters[0].Brokers) != 1 || clusters[0].UpdatedAt.IsZero() {
+		t.Errorf("unexpected clusters %+v", clusters)
+	}
+
+	var topic topicSnapshot
+	if code := get("/api/v1/topics/orders", &topic); code != http.StatusOK {
+		t.Fatal("expected 200, got", code)
+	}
+	if len(topic.Partitions) != 1 || topic.Partitions[0].EndOffset == nil || *topic.Partitions[0].EndOffset != 3 {
+		t.Errorf("unexpected topic %+v", topic)
+	}
+
+	var group groupSnapshot
+	if code := get("/api/v1/groups/billing", &group); code != http.StatusOK {
+		t.Fatal("expected 200, got", code)
+	}
+	if len(group.Partitions) != 1 || group.Partitions[0].Offset == nil || group.Lag != 3-*group.Partitions[0].Offset {
+		t.Errorf("unexpected group %+v", group)
+	}
+
+	if code := get("/api/v1/groups/unknown", nil); code != http.StatusNotFound {
+		t.Error("expected 404 for an unknown group, got", code)
+	}
+}
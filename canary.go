@@ -0,0 +1,351 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// canary produces records to a partition led by every broker and consumes
+// them back, catching brokers that are in the metadata but can't serve
+// clients.
+type canary struct {
+	config  Canary
+	metrics canaryMetrics
+
+	admin    *kadm.Client
+	producer *kgo.Client
+	consumer *kgo.Client
+}
+
+func newCanary(conf Config, metrics canaryMetrics) (*canary, error) {
+	opts, err := franzOpts(conf, nil)
+	if err != nil {
+		return nil, err
+	}
+	// both clients append their own options
+	opts = slices.Clip(opts)
+
+	producer, err := kgo.NewClient(append(opts,
+		kgo.DefaultProduceTopic(conf.Canary.Topic),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.ProduceRequestTimeout(conf.Canary.Timeout),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// only records produced from now on are of interest, and partitions
+	// added along with brokers are picked up on the next metadata refresh,
+	// which kgo doesn't allow more often than every 5s
+	consumer, err := kgo.NewClient(append(opts,
+		kgo.ConsumeTopics(conf.Canary.Topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AfterMilli(time.Now().UnixMilli())),
+		kgo.MetadataMaxAge(max(conf.Canary.Interval, 5*time.Second)),
+	)...)
+	if err != nil {
+		producer.Close()
+		return nil, err
+	}
+
+	return &canary{
+		config:   conf.Canary,
+		metrics:  metrics,
+		admin:    kadm.NewClient(producer),
+		producer: producer,
+		consumer: consumer,
+	}, nil
+}
+
+// run probes the cluster every interval until ctx is done.
+func (c *canary) run(ctx context.Context) {
+	defer c.close()
+
+	t := time.NewTicker(c.config.Interval)
+	defer t.Stop()
+
+	for {
+		if err := c.probe(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to probe the cluster with canary records")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *canary) close() {
+	c.producer.Close()
+	c.consumer.Close()
+}
+
+// probe produces a record to every partition of the canary topic and consumes
+// them back, exporting whether the leader of each partition is available.
+func (c *canary) probe(ctx context.Context) error {
+	leaders, brokers, err := c.ensureTopic(ctx)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.config.Timeout)
+	defer cancel()
+
+	// the key tells this probe's records apart from late ones of previous probes
+	key := []byte(strconv.FormatInt(time.Now().UnixNano(), 10))
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		produced = make(map[int32]bool, len(leaders))
+	)
+	for partition, leader := range leaders {
+		labels := prometheus.Labels{"id": strconv.Itoa(int(leader))}
+		sent := time.Now()
+
+		wg.Add(1)
+		c.producer.Produce(ctx, &kgo.Record{
+			Key:       key,
+			Value:     []byte(strconv.FormatInt(sent.UnixNano(), 10)),
+			Partition: partition,
+		}, func(r *kgo.Record, err error) {
+			defer wg.Done()
+
+			if err != nil {
+				log.Error().Err(err).Int32("partition", r.Partition).Int32("broker", leader).Msg("failed to produce canary record")
+				c.metrics.produceErrors.With(labels).Inc()
+				return
+			}
+
+			c.metrics.produceLatency.With(labels).Observe(time.Since(sent).Seconds())
+			mu.Lock()
+			produced[r.Partition] = true
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+
+	consumed := make(map[int32]bool, len(produced))
+	for len(consumed) < len(produced) && ctx.Err() == nil {
+		fetches := c.consumer.PollFetches(ctx)
+		fetches.EachError(func(topic string, partition int32, err error) {
+			if !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, context.Canceled) {
+				log.Error().Err(err).Str("topic", topic).Int32("partition", partition).Msg("failed to consume canary records")
+			}
+		})
+
+		received := time.Now()
+		fetches.EachRecord(func(r *kgo.Record) {
+			sent, err := strconv.ParseInt(string(r.Value), 10, 64)
+			if err != nil {
+				return
+			}
+
+			leader, ok := leaders[r.Partition]
+			if !ok {
+				return
+			}
+
+			c.metrics.endToEndLatency.With(prometheus.Labels{
+				"id": strconv.Itoa(int(leader)),
+			}).Observe(received.Sub(time.Unix(0, sent)).Seconds())
+
+			if string(r.Key) == string(key) {
+				consumed[r.Partition] = true
+			}
+		})
+	}
+
+	// a broker leading several partitions is only available if all of them
+	// were consumed, and a broker leading none of them can't be probed at all
+	available := make(map[int32]bool, len(brokers))
+	for _, broker := range brokers {
+		available[broker] = false
+	}
+	seen := make(map[int32]bool, len(brokers))
+	for partition, leader := range leaders {
+		available[leader] = consumed[partition] && (available[leader] || !seen[leader])
+		seen[leader] = true
+	}
+
+	c.metrics.available.Reset()
+	for broker, ok := range available {
+		if !seen[broker] {
+			log.Warn().Int32("broker", broker).Msg("broker leads no canary partition")
+		}
+
+		value := 0
+		if ok {
+			value = 1
+		}
+
+		c.metrics.available.With(prometheus.Labels{
+			"id": strconv.Itoa(int(broker)),
+		}).Set(float64(value))
+	}
+
+	return nil
+}
+
+// ensureTopic creates the canary topic, or adds partitions to it, so that
+// every broker is the preferred leader of a partition, and returns the leader
+// of every partition and the ID of every broker.
+func (c *canary) ensureTopic(ctx context.Context) (map[int32]int32, []int32, error) {
+	metadata, err := c.admin.Metadata(ctx, c.config.Topic)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	brokers := metadata.Brokers.NodeIDs()
+	slices.Sort(brokers)
+	replicationFactor := min(int(c.config.ReplicationFactor), len(brokers))
+	topic := metadata.Topics[c.config.Topic]
+
+	switch {
+	case errors.Is(topic.Err, kerr.UnknownTopicOrPartition):
+		log.Info().Str("topic", c.config.Topic).Int("partitions", len(brokers)).Int("replication_factor", replicationFactor).Msg("creating canary topic")
+
+		if err := c.createTopic(ctx, replicaAssignment(brokers, brokers, replicationFactor)); err != nil && !errors.Is(err, kerr.TopicAlreadyExists) {
+			return nil, nil, err
+		}
+	case topic.Err != nil:
+		return nil, nil, topic.Err
+	default:
+		leaderless := withoutPreferredLeadership(brokers, topic)
+		if len(leaderless) == 0 {
+			return partitionLeaders(topic), brokers, nil
+		}
+
+		log.Info().Str("topic", c.config.Topic).Int("partitions", len(leaderless)).Msg("adding partitions to canary topic for new brokers")
+
+		if err := c.addPartitions(ctx, len(topic.Partitions), replicaAssignment(leaderless, brokers, replicationFactor)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the partitions changed, look them up again
+	metadata, err = c.admin.Metadata(ctx, c.config.Topic)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := metadata.Topics[c.config.Topic].Err; err != nil {
+		return nil, nil, err
+	}
+	return partitionLeaders(metadata.Topics[c.config.Topic]), brokers, nil
+}
+
+// createTopic creates the canary topic with a partition per replica
+// assignment. kadm doesn't allow assigning replicas, so the request is issued
+// directly.
+func (c *canary) createTopic(ctx context.Context, assignment [][]int32) error {
+	topic := kmsg.NewCreateTopicsRequestTopic()
+	topic.Topic = c.config.Topic
+	topic.NumPartitions = -1
+	topic.ReplicationFactor = -1
+	for partition, replicas := range assignment {
+		a := kmsg.NewCreateTopicsRequestTopicReplicaAssignment()
+		a.Partition = int32(partition)
+		a.Replicas = replicas
+		topic.ReplicaAssignment = append(topic.ReplicaAssignment, a)
+	}
+
+	req := kmsg.NewPtrCreateTopicsRequest()
+	req.TimeoutMillis = int32(c.config.Timeout.Milliseconds())
+	req.Topics = append(req.Topics, topic)
+
+	resp, err := req.RequestWith(ctx, c.producer)
+	if err != nil {
+		return err
+	}
+	if len(resp.Topics) != 1 {
+		return fmt.Errorf("expected one topic in the create topics response, got %d", len(resp.Topics))
+	}
+	return kerr.ErrorForCode(resp.Topics[0].ErrorCode)
+}
+
+// addPartitions adds a partition per replica assignment to the canary topic,
+// which has the given number of partitions.
+func (c *canary) addPartitions(ctx context.Context, partitions int, assignment [][]int32) error {
+	topic := kmsg.NewCreatePartitionsRequestTopic()
+	topic.Topic = c.config.Topic
+	topic.Count = int32(partitions + len(assignment))
+	for _, replicas := range assignment {
+		a := kmsg.NewCreatePartitionsRequestTopicAssignment()
+		a.Replicas = replicas
+		topic.Assignment = append(topic.Assignment, a)
+	}
+
+	req := kmsg.NewPtrCreatePartitionsRequest()
+	req.TimeoutMillis = int32(c.config.Timeout.Milliseconds())
+	req.Topics = append(req.Topics, topic)
+
+	resp, err := req.RequestWith(ctx, c.producer)
+	if err != nil {
+		return err
+	}
+	if len(resp.Topics) != 1 {
+		return fmt.Errorf("expected one topic in the create partitions response, got %d", len(resp.Topics))
+	}
+	return kerr.ErrorForCode(resp.Topics[0].ErrorCode)
+}
+
+// replicaAssignment returns the replicas of a partition per leader, the leader
+// followed by the brokers after it, so that every leader is the preferred
+// leader of its partition and the followers are spread over the brokers.
+func replicaAssignment(leaders []int32, brokers []int32, replicationFactor int) [][]int32 {
+	assignment := make([][]int32, 0, len(leaders))
+	for _, leader := range leaders {
+		start := slices.Index(brokers, leader)
+		replicas := make([]int32, 0, replicationFactor)
+		for i := range replicationFactor {
+			replicas = append(replicas, brokers[(start+i)%len(brokers)])
+		}
+		assignment = append(assignment, replicas)
+	}
+	return assignment
+}
+
+// withoutPreferredLeadership returns the brokers that aren't the preferred
+// leader, the first replica, of any partition of the topic.
+func withoutPreferredLeadership(brokers []int32, topic kadm.TopicDetail) []int32 {
+	preferred := make(map[int32]bool, len(topic.Partitions))
+	for _, partition := range topic.Partitions {
+		if len(partition.Replicas) > 0 {
+			preferred[partition.Replicas[0]] = true
+		}
+	}
+
+	var leaderless []int32
+	for _, broker := range brokers {
+		if !preferred[broker] {
+			leaderless = append(leaderless, broker)
+		}
+	}
+	return leaderless
+}
+
+// partitionLeaders returns the leader of every partition of the topic that has
+// one.
+func partitionLeaders(topic kadm.TopicDetail) map[int32]int32 {
+	leaders := make(map[int32]int32, len(topic.Partitions))
+	for _, partition := range topic.Partitions {
+		if partition.Err == nil && partition.Leader >= 0 {
+			leaders[partition.Partition] = partition.Leader
+		}
+	}
+	return leaders
+}
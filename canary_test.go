@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestCanary(t *testing.T) {
+	numBrokers := 3
+
+	c, conf := newTestCluster(t, kfake.NumBrokers(numBrokers))
+
+	// kfake doesn't support assigning replicas, so check the assignment and
+	// let kfake place the partitions itself
+	var preferred []int32
+	c.ControlKey(int16(kmsg.CreateTopics), func(kreq kmsg.Request) (kmsg.Response, error, bool) {
+		req := kreq.(*kmsg.CreateTopicsRequest)
+		for i := range req.Topics {
+			topic := &req.Topics[i]
+			for _, assignment := range topic.ReplicaAssignment {
+				preferred = append(preferred, assignment.Replicas[0])
+			}
+			topic.NumPartitions = int32(len(topic.ReplicaAssignment))
+			topic.ReplicationFactor = int16(len(topic.ReplicaAssignment[0].Replicas))
+			topic.ReplicaAssignment = nil
+		}
+		return nil, nil, false
+	})
+
+	conf.Canary = Canary{
+		Enabled:           true,
+		Topic:             "canary",
+		ReplicationFactor: 3,
+		Interval:          time.Second,
+		Timeout:           5 * time.Second,
+	}
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+	defer e.canary.close()
+
+	if err := e.canary.probe(context.Background()); err != nil {
+		t.Fatal(err, "failed to probe")
+	}
+
+	metadata, err := e.client.Metadata(context.Background(), "canary")
+	if err != nil {
+		t.Fatal(err, "failed to get metadata")
+	}
+	if got := len(metadata.Topics["canary"].Partitions); got != numBrokers {
+		t.Fatalf("expected a canary partition per broker, got %d", got)
+	}
+
+	ids := metadata.Brokers.NodeIDs()
+	slices.Sort(ids)
+	slices.Sort(preferred)
+	if !slices.Equal(preferred, ids) {
+		t.Errorf("expected every broker to be the preferred leader of a partition, got %v", preferred)
+	}
+
+	brokers := make(map[string]bool)
+	for _, leader := range partitionLeaders(metadata.Topics["canary"]) {
+		brokers[strconv.Itoa(int(leader))] = true
+	}
+
+	// kfake picks leaders at random, brokers leading no partition can't be
+	// probed and are reported unavailable
+	if got := testutil.CollectAndCount(e.metrics.canary.available); got != numBrokers {
+		t.Errorf("expected the availability of %d brokers, got %d", numBrokers, got)
+	}
+	for _, id := range ids {
+		broker := strconv.Itoa(int(id))
+		expected := 0.0
+		if brokers[broker] {
+			expected = 1
+		}
+		if got := testutil.ToFloat64(e.metrics.canary.available.With(prometheus.Labels{"id": broker})); got != expected {
+			t.Errorf("expected availability %v of broker %s, got %v", expected, broker, got)
+		}
+	}
+
+	if got := testutil.CollectAndCount(e.metrics.canary.produceLatency); got != len(brokers) {
+		t.Errorf("expected produce latencies of %d brokers, got %d", len(brokers), got)
+	}
+	if got := testutil.CollectAndCount(e.metrics.canary.endToEndLatency); got != len(brokers) {
+		t.Errorf("expected end to end latencies of %d brokers, got %d", len(brokers), got)
+	}
+}
+
+func TestReplicaAssignment(t *testing.T) {
+	brokers := []int32{1, 2, 3}
+
+	got := replicaAssignment(brokers, brokers, 2)
+	if expected := [][]int32{{1, 2}, {2, 3}, {3, 1}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	// broker 3 joined a cluster whose canary partitions were led by 1 and 2
+	topic := kadm.TopicDetail{Partitions: kadm.PartitionDetails{
+		0: {Partition: 0, Replicas: []int32{1, 2}},
+		1: {Partition: 1, Replicas: []int32{2, 1}},
+	}}
+	leaderless := withoutPreferredLeadership(brokers, topic)
+	if expected := []int32{3}; !reflect.DeepEqual(leaderless, expected) {
+		t.Errorf("expected %v without a partition, got %v", expected, leaderless)
+	}
+	if got, expected := replicaAssignment(leaderless, brokers, 3), [][]int32{{3, 1, 2}}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// detectChanges compares the metadata of the current export cycle with the one
+// from the previous cycle and counts the leadership, ISR and controller changes
+// that happened in between. Gauges only show the state at scrape time, so a
+// partition flapping between scrapes is otherwise invisible. The quorum leaders
+// are the leaders of the metadata quorum of both cycles, -1 when it couldn't be
+// described.
+func (e *exporter) detectChanges(previous, current kadm.Metadata, previousQuorumLeader, quorumLeader int32) {
+	// KRaft brokers report a random alive broker as the controller in their
+	// metadata, the leader of the metadata quorum is the actual controller
+	previousController, controller := previous.Controller, current.Controller
+	compare := true
+	if previousQuorumLeader >= 0 || quorumLeader >= 0 {
+		previousController, controller = previousQuorumLeader, quorumLeader
+		compare = previousQuorumLeader >= 0 && quorumLeader >= 0
+	}
+
+	if compare && previousController != controller {
+		e.metrics.changes.controllerChanges.Inc()
+
+		log.Info().
+			Int32("previous_controller", previousController).
+			Int32("controller", controller).
+			Msg("controller changed")
+		e.publish(eventControllerChange, event{Previous: previousController, Current: controller})
+	}
+
+	for _, broker := range current.Brokers {
+		if !slices.Contains(previous.Brokers.NodeIDs(), broker.NodeID) {
+			id := broker.NodeID
+			log.Info().Int32("broker", id).Str("host", broker.Host).Msg("broker joined")
+			e.publish(eventBrokerJoined, event{Broker: &id})
+		}
+	}
+
+	for _, broker := range previous.Brokers {
+		if !slices.Contains(current.Brokers.NodeIDs(), broker.NodeID) {
+			id := broker.NodeID
+			log.Info().Int32("broker", id).Str("host", broker.Host).Msg("broker left")
+			e.publish(eventBrokerLeft, event{Broker: &id})
+		}
+	}
+
+	for _, topic := range current.Topics {
+		previousTopic, ok := previous.Topics[topic.Topic]
+		if !ok {
+			// new topics have nothing to compare against
+			continue
+		}
+
+		for _, partition := range topic.Partitions {
+			previousPartition, ok := previousTopic.Partitions[partition.Partition]
+			if !ok || partition.Err != nil || previousPartition.Err != nil {
+				continue
+			}
+
+			labels := prometheus.Labels{
+				"topic":     topic.Topic,
+				"partition": strconv.Itoa(int(partition.Partition)),
+			}
+			number := partition.Partition
+
+			if previousPartition.Leader != partition.Leader {
+				e.metrics.changes.leaderChanges.With(labels).Inc()
+				e.metrics.changes.brokerLeaderElections.With(prometheus.Labels{
+					"id": strconv.Itoa(int(partition.Leader)),
+				}).Inc()
+
+				log.Info().
+					Str("topic", topic.Topic).
+					Int32("partition", partition.Partition).
+					Int32("previous_leader", previousPartition.Leader).
+					Int32("leader", partition.Leader).
+					Msg("partition leader changed")
+				e.publish(eventLeaderChange, event{
+					Topic:     topic.Topic,
+					Partition: &number,
+					Previous:  previousPartition.Leader,
+					Current:   partition.Leader,
+				})
+			}
+
+			// a replica can leave and another one join the ISR in between two
+			// cycles, so count both directions independently
+			removed := difference(previousPartition.ISR, partition.ISR)
+			added := difference(partition.ISR, previousPartition.ISR)
+
+			if len(removed) > 0 {
+				e.metrics.changes.isrShrinks.With(labels).Inc()
+				for _, replica := range removed {
+					e.metrics.changes.brokerISRShrinks.With(prometheus.Labels{
+						"id": strconv.Itoa(int(replica)),
+					}).Inc()
+				}
+
+				log.Info().
+					Str("topic", topic.Topic).
+					Int32("partition", partition.Partition).
+					Ints32("removed", removed).
+					Ints32("isr", partition.ISR).
+					Msg("partition isr shrunk")
+				e.publish(eventISRShrink, event{
+					Topic:     topic.Topic,
+					Partition: &number,
+					Previous:  previousPartition.ISR,
+					Current:   partition.ISR,
+				})
+			}
+
+			if len(added) > 0 {
+				e.metrics.changes.isrExpands.With(labels).Inc()
+				for _, replica := range added {
+					e.metrics.changes.brokerISRExpands.With(prometheus.Labels{
+						"id": strconv.Itoa(int(replica)),
+					}).Inc()
+				}
+
+				log.Info().
+					Str("topic", topic.Topic).
+					Int32("partition", partition.Partition).
+					Ints32("added", added).
+					Ints32("isr", partition.ISR).
+					Msg("partition isr expanded")
+				e.publish(eventISRExpand, event{
+					Topic:     topic.Topic,
+					Partition: &number,
+					Previous:  previousPartition.ISR,
+					Current:   partition.ISR,
+				})
+			}
+		}
+	}
+}
+
+// difference returns the replicas in a that are not in b.
+func difference(a, b []int32) []int32 {
+	var diff []int32
+	for _, replica := range a {
+		if !slices.Contains(b, replica) {
+			diff = append(diff, replica)
+		}
+	}
+
+	return diff
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sse"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+func TestDetectChanges(t *testing.T) {
+	e := &exporter{metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), events: sse.NewHub()}
+
+	metadata := func(controller, leader int32, isr ...int32) kadm.Metadata {
+		return kadm.Metadata{
+			Controller: controller,
+			Topics: kadm.TopicDetails{
+				"topic1": {
+					Topic: "topic1",
+					Partitions: kadm.PartitionDetails{
+						0: {Topic: "topic1", Partition: 0, Leader: leader, ISR: isr},
+					},
+				},
+			},
+		}
+	}
+
+	// broker 2 leaves and broker 3 joins the ISR while leadership moves to 1
+	e.detectChanges(metadata(0, 0, 0, 1, 2), metadata(1, 1, 0, 1, 3), -1, -1)
+
+	if got := testutil.ToFloat64(e.metrics.changes.controllerChanges); got != 1 {
+		t.Fatal("expected 1 controller change, got", got)
+	}
+
+	partition := prometheus.Labels{"topic": "topic1", "partition": "0"}
+	for name, counter := range map[string]prometheus.Counter{
+		"leader changes":            e.metrics.changes.leaderChanges.With(partition),
+		"isr shrinks":               e.metrics.changes.isrShrinks.With(partition),
+		"isr expands":               e.metrics.changes.isrExpands.With(partition),
+		"broker 1 leader elections": e.metrics.changes.brokerLeaderElections.With(prometheus.Labels{"id": "1"}),
+		"broker 2 isr shrinks":      e.metrics.changes.brokerISRShrinks.With(prometheus.Labels{"id": "2"}),
+		"broker 3 isr expands":      e.metrics.changes.brokerISRExpands.With(prometheus.Labels{"id": "3"}),
+	} {
+		if got := testutil.ToFloat64(counter); got != 1 {
+			t.Fatalf("expected 1 for %s, got %v", name, got)
+		}
+	}
+
+	// nothing changed, nothing is counted
+	e.detectChanges(metadata(1, 1, 0, 1, 3), metadata(1, 1, 3, 1, 0), -1, -1)
+	if got := testutil.ToFloat64(e.metrics.changes.leaderChanges.With(partition)); got != 1 {
+		t.Fatal("expected leader changes to stay at 1, got", got)
+	}
+}
+
+func TestDetectQuorumControllerChanges(t *testing.T) {
+	e := &exporter{metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), events: sse.NewHub()}
+
+	metadata := func(controller int32) kadm.Metadata {
+		return kadm.Metadata{Controller: controller}
+	}
+
+	for _, tc := range []struct {
+		name                               string
+		previousController, controller     int32
+		previousQuorumLeader, quorumLeader int32
+		total                              float64
+	}{
+		{name: "random metadata controller", previousController: 1, controller: 2, previousQuorumLeader: 3, quorumLeader: 3},
+		{name: "quorum leader changed", previousController: 1, controller: 1, previousQuorumLeader: 3, quorumLeader: 4, total: 1},
+		{name: "quorum not described", previousController: 1, controller: 2, previousQuorumLeader: 4, quorumLeader: -1, total: 1},
+		{name: "quorum described again", previousController: 2, controller: 1, previousQuorumLeader: -1, quorumLeader: 5, total: 1},
+	} {
+		e.detectChanges(metadata(tc.previousController), metadata(tc.controller), tc.previousQuorumLeader, tc.quorumLeader)
+		if got := testutil.ToFloat64(e.metrics.changes.controllerChanges); got != tc.total {
+			t.Fatalf("%s: expected %v controller changes in total, got %v", tc.name, tc.total, got)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// metadataVersionFeature is the finalized feature tracking the KRaft
+// metadata.version, it is absent on ZooKeeper based clusters.
+const metadataVersionFeature = "metadata.version"
+
+// exportCluster exports the identity of the cluster along with the API
+// versions and features supported by every broker. It returns the detected
+// Kafka release of each broker that answered the ApiVersions request.
+func (e *exporter) exportCluster(ctx context.Context, metadata kadm.Metadata) (map[int32]string, error) {
+	// the identity of the cluster comes from the metadata, so export it even
+	// if the brokers fail to answer ApiVersions
+	e.exportClusterInfo(metadata, "unknown")
+
+	versions, err := e.client.ApiVersions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// finalized features are propagated to every broker asynchronously, so
+	// prefer the response with the most recent finalized features epoch
+	var finalized *kmsg.ApiVersionsResponse
+	releases := make(map[int32]string, len(versions))
+
+	// ranges are keyed by broker, so drop brokers that have left the cluster
+	e.metrics.broker.apiMinVersion.Reset()
+	e.metrics.broker.apiMaxVersion.Reset()
+	e.metrics.broker.supportedFeatureMaxLevel.Reset()
+
+	for _, version := range versions.Sorted() {
+		if version.Err != nil {
+			log.Error().Err(version.Err).Int32("broker", version.NodeID).Msg("failed to get broker api versions")
+			e.onErrors.Record(version.Err)
+			continue
+		}
+
+		id := strconv.Itoa(int(version.NodeID))
+		releases[version.NodeID] = version.VersionGuess()
+
+		version.EachKeySorted(func(key, min, max int16) {
+			labels := prometheus.Labels{
+				"id":  id,
+				"api": kmsg.NameForKey(key),
+			}
+
+			e.metrics.broker.apiMinVersion.With(labels).Set(float64(min))
+			e.metrics.broker.apiMaxVersion.With(labels).Set(float64(max))
+		})
+
+		raw := version.Raw()
+		for _, feature := range raw.SupportedFeatures {
+			e.metrics.broker.supportedFeatureMaxLevel.With(prometheus.Labels{
+				"id":      id,
+				"feature": feature.Name,
+			}).Set(float64(feature.MaxVersion))
+		}
+
+		if finalized == nil || raw.FinalizedFeaturesEpoch > finalized.FinalizedFeaturesEpoch {
+			finalized = raw
+		}
+	}
+
+	metadataVersion := "unknown"
+	if finalized != nil {
+		e.metrics.cluster.finalizedFeatureLevel.Reset()
+		for _, feature := range finalized.FinalizedFeatures {
+			e.metrics.cluster.finalizedFeatureLevel.With(prometheus.Labels{
+				"feature": feature.Name,
+			}).Set(float64(feature.MaxVersionLevel))
+
+			if feature.Name == metadataVersionFeature {
+				metadataVersion = strconv.Itoa(int(feature.MaxVersionLevel))
+			}
+		}
+	}
+
+	e.exportClusterInfo(metadata, metadataVersion)
+
+	return releases, nil
+}
+
+func (e *exporter) exportClusterInfo(metadata kadm.Metadata, metadataVersion string) {
+	// the controller is a label, so only the current one should be present
+	e.metrics.cluster.info.Reset()
+	e.metrics.cluster.info.With(prometheus.Labels{
+		"cluster_id":       metadata.Cluster,
+		"controller":       strconv.Itoa(int(metadata.Controller)),
+		"metadata_version": metadataVersion,
+	}).Set(1)
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestClusterInfoWithoutApiVersions(t *testing.T) {
+	_, conf := newTestCluster(t, kfake.NumBrokers(1))
+
+	client, kafka, err := conf.Franzgo(nil)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	e := &exporter{config: conf, metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), client: client, kafka: kafka}
+
+	// ApiVersions fails on a canceled context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := e.exportCluster(ctx, kadm.Metadata{Cluster: "kfake", Controller: 1}); err == nil {
+		t.Fatal("expected ApiVersions to fail")
+	}
+
+	if value := testutil.ToFloat64(e.metrics.cluster.info.WithLabelValues("kfake", "1", "unknown")); value != 1 {
+		t.Error("expected the cluster info to be exported from the metadata, got", value)
+	}
+	if n := testutil.CollectAndCount(e.metrics.cluster.info); n != 1 {
+		t.Error("expected a single cluster info series, got", n)
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"context"
-	"crypto/tls"
+	"errors"
 	"fmt"
+	"net"
+	"net/netip"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
 	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kgo"
 	"github.com/twmb/franz-go/pkg/sasl/plain"
@@ -18,66 +23,400 @@ import (
 
 type Config struct {
 	Kafka
+	Events
+	LagStatus
+	Transactions
+	Quotas
+	ACLs
+	Drift
+	Canary
+	RemoteWrite
+	OTLP
+	Sinks
+	Publish
+	UI
+	Probe
+	Metrics
 
-	ListenAddress      Address       `arg:"--listen.address" help:"Address to listen on for serving Prometheus metrics" default:":9308" placeholder:"ADDRESS"`
-	RefreshInterval    time.Duration `arg:"--refresh.interval" help:"Interval at which to refresh the metrics from Kafka" default:"30s" placeholder:"DURATION"`
-	ContinuousFailures int           `arg:"--continuous.failures" help:"Number of continuous failures before exiting" default:"10"`
-	LogLevel           string        `arg:"--log.level" help:"Log level" default:"debug"`
+	CheckPermissions *CheckPermissions `arg:"subcommand:check-permissions" help:"Check which collectors the exporter is authorized to run and exit"`
+
+	ListenAddress       ListenAddress  `arg:"--listen.address" help:"Address to listen on for serving Prometheus metrics" default:":9308" placeholder:"ADDRESS"`
+	WebConfigFile       string         `arg:"--web.config.file" help:"YAML file configuring TLS, client certificate, basic auth and bearer token protection of the endpoints" placeholder:"FILE"`
+	RefreshInterval     time.Duration  `arg:"--refresh.interval" help:"Interval at which to refresh the metrics from Kafka" default:"30s" placeholder:"DURATION"`
+	RateWindow          time.Duration  `arg:"--rate.window" help:"Smoothing window of the produce and consume rates computed from offsets" default:"5m" placeholder:"DURATION"`
+	ReadCommittedGroups *regexp.Regexp `arg:"--group.read-committed" help:"Regex of consumer groups whose lag is computed against the last stable offset instead of the end offset" placeholder:"REGEX"`
+	ContinuousFailures  int            `arg:"--continuous.failures" help:"Number of continuous failures before exiting" default:"10"`
+	LogLevel            string         `arg:"--log.level" help:"Log level" default:"debug"`
 }
 
 type Kafka struct {
-	Servers []Address `arg:"--kafka.servers,required" help:"Address of the Kafka brokers" placeholder:"BROKER_ADDRESS"`
+	Servers []Address `arg:"--kafka.servers,required" help:"Address of the Kafka brokers, host:port or dns+srv://name to look them up from SRV records" placeholder:"BROKER_ADDRESS"`
 	SASL
 	TLS
 }
 
 type SASL struct {
-	Enabled   bool   `arg:"--sasl.enabled" help:"Enable SASL authentication" default:"false"`
-	Username  string `arg:"--sasl.username,env:SASL_USERNAME" help:"Username for SASL authentication"`
-	Password  string `arg:"--sasl.password,env:SASL_PASSWORD" help:"Password for SASL authentication"`
-	Mechanism string `arg:"--sasl.mechanism" help:"SASL mechanism to use" default:"PLAIN"`
+	Enabled   bool   `arg:"--sasl.enabled" help:"Enable SASL authentication" default:"false" yaml:"enabled"`
+	Username  string `arg:"--sasl.username,env:SASL_USERNAME" help:"Username for SASL authentication" yaml:"username"`
+	Password  string `arg:"--sasl.password,env:SASL_PASSWORD" help:"Password for SASL authentication" yaml:"password"`
+	Mechanism string `arg:"--sasl.mechanism" help:"SASL mechanism to use" default:"PLAIN" yaml:"mechanism"`
+}
+
+type Events struct {
+	LagThreshold int64 `arg:"--events.lag-threshold" help:"Consumer group lag above which lag threshold events are streamed on /events, 0 disables them" default:"0"`
+}
+
+type LagStatus struct {
+	WindowSize int   `arg:"--status.window-size" help:"Number of export cycles over which consumer group offsets and lag are evaluated" default:"10"`
+	WarningLag int64 `arg:"--status.warning-lag" help:"Lag from which a consumer group partition is in WARNING status, 0 disables it" default:"0"`
+	ErrorLag   int64 `arg:"--status.error-lag" help:"Lag from which a consumer group partition is in ERROR status, 0 disables it" default:"0"`
+}
+
+type Transactions struct {
+	Enabled          bool          `arg:"--transactions.enabled" help:"Enable collecting producer and transaction state" default:"false"`
+	HangingThreshold time.Duration `arg:"--transactions.hanging-threshold" help:"Age from which an open transaction is flagged as hanging" default:"15m" placeholder:"DURATION"`
+}
+
+type Quotas struct {
+	Enabled bool `arg:"--quotas.enabled" help:"Enable collecting client quotas and SCRAM credentials" default:"false"`
+}
+
+type ACLs struct {
+	Enabled bool `arg:"--acls.enabled" help:"Enable collecting ACL counts per resource type, principal and operation" default:"false"`
+}
+
+type Drift struct {
+	Enabled      bool   `arg:"--drift.enabled" help:"Enable detecting dynamic broker configs that differ from the majority of brokers" default:"false"`
+	DesiredState string `arg:"--drift.desired-state" help:"YAML file of desired broker and topic configs to detect drift from, requires --drift.enabled" placeholder:"FILE"`
+}
+
+type Canary struct {
+	Enabled           bool          `arg:"--canary.enabled" help:"Enable producing and consuming canary records through every broker" default:"false"`
+	Topic             string        `arg:"--canary.topic" help:"Topic to produce canary records to, created with a partition per broker if missing" default:"__kafka_exporter_canary" placeholder:"TOPIC"`
+	ReplicationFactor int16         `arg:"--canary.replication-factor" help:"Replication factor of the canary topic, capped to the number of brokers" default:"3"`
+	Interval          time.Duration `arg:"--canary.interval" help:"Interval at which to produce canary records" default:"15s" placeholder:"DURATION"`
+	Timeout           time.Duration `arg:"--canary.timeout" help:"Time after which a canary record that wasn't produced or consumed marks its broker unavailable" default:"10s" placeholder:"DURATION"`
+}
+
+type RemoteWrite struct {
+	URLs        []string      `arg:"--remote-write.url" help:"Prometheus remote write endpoint to push the metrics to after every refresh, may be repeated" placeholder:"URL"`
+	Username    string        `arg:"--remote-write.username,env:REMOTE_WRITE_USERNAME" help:"Username for basic authentication to the remote write endpoints"`
+	Password    string        `arg:"--remote-write.password,env:REMOTE_WRITE_PASSWORD" help:"Password for basic authentication to the remote write endpoints"`
+	BearerToken string        `arg:"--remote-write.bearer-token,env:REMOTE_WRITE_BEARER_TOKEN" help:"Bearer token for the remote write endpoints, takes precedence over basic authentication"`
+	Timeout     time.Duration `arg:"--remote-write.timeout" help:"Timeout of a remote write request" default:"30s" placeholder:"DURATION"`
+	QueueSize   int           `arg:"--remote-write.queue-size" help:"Number of refreshes queued per endpoint while it's unavailable, the newest are dropped past it" default:"10"`
+	MaxRetries  int           `arg:"--remote-write.max-retries" help:"Number of times a request failing with a network error, 5xx or 429 is retried" default:"3"`
+	MinBackoff  time.Duration `arg:"--remote-write.min-backoff" help:"Backoff before the first retry, doubled on every retry" default:"1s" placeholder:"DURATION"`
+	MaxBackoff  time.Duration `arg:"--remote-write.max-backoff" help:"Maximum backoff between retries" default:"30s" placeholder:"DURATION"`
+}
+
+type OTLP struct {
+	Endpoint string            `arg:"--otlp.endpoint" help:"URL of the OpenTelemetry collector to push the metrics to, e.g. http://localhost:4317, TLS is used for https" placeholder:"URL"`
+	Protocol string            `arg:"--otlp.protocol" help:"OTLP protocol, grpc or http/protobuf" default:"grpc"`
+	Headers  map[string]string `arg:"--otlp.header" help:"Header sent to the collector, may be repeated" placeholder:"KEY=VALUE"`
+	Interval time.Duration     `arg:"--otlp.interval" help:"Interval at which to push the metrics to the collector" default:"30s" placeholder:"DURATION"`
+	Timeout  time.Duration     `arg:"--otlp.timeout" help:"Timeout of a push to the collector" default:"10s" placeholder:"DURATION"`
+	Instance string            `arg:"--otlp.instance" help:"service.instance.id resource attribute, defaults to the hostname"`
+}
+
+type Sinks struct {
+	StatsD      string          `arg:"--statsd.address" help:"Address of a StatsD server to send the metrics to as DogStatsD gauges over UDP" placeholder:"ADDRESS"`
+	Graphite    string          `arg:"--graphite.address" help:"Address of a Graphite server to send the metrics to over the plaintext protocol" placeholder:"ADDRESS"`
+	InfluxURL   string          `arg:"--influx.url" help:"InfluxDB write URL to send the metrics to in the line protocol, e.g. http://localhost:8086/api/v2/write?org=org&bucket=kafka" placeholder:"URL"`
+	InfluxToken string          `arg:"--influx.token,env:INFLUX_TOKEN" help:"Token for the InfluxDB write URL"`
+	Templates   []sink.Template `arg:"--sink.template" help:"Template mapping the labels of the metrics matching a regex into a dotted path for the StatsD, Graphite and InfluxDB sinks, the first matching one applies, e.g. ^kafka_consumergroup_=kafka.{consumergroup}.{topic}.{partition}.{__name__}" placeholder:"REGEX=TEMPLATE"`
+	Timeout     time.Duration   `arg:"--sink.timeout" help:"Timeout of sending the metrics to each sink after every refresh" default:"10s" placeholder:"DURATION"`
+}
+
+// sinks returns the configured StatsD, Graphite and InfluxDB sinks.
+func (s Sinks) sinks() []sink.Sink {
+	var sinks []sink.Sink
+	if s.StatsD != "" {
+		sinks = append(sinks, sink.StatsD{Address: s.StatsD, Templates: s.Templates})
+	}
+	if s.Graphite != "" {
+		sinks = append(sinks, sink.Graphite{Address: s.Graphite, Templates: s.Templates})
+	}
+	if s.InfluxURL != "" {
+		sinks = append(sinks, sink.Influx{URL: s.InfluxURL, Token: s.InfluxToken, Templates: s.Templates})
+	}
+	return sinks
+}
+
+type Publish struct {
+	Topic  string `arg:"--publish.topic" help:"Topic to produce the consumer group lag and topic offset samples to after every refresh" placeholder:"TOPIC"`
+	Format string `arg:"--publish.format" help:"Format of the published samples, json, avro or protobuf" default:"json"`
+
+	// the published samples go to the exported cluster unless KafkaServers is set
+	KafkaServers          []Address `arg:"--publish.kafka.servers" help:"Address of the brokers of the cluster to publish to, defaults to the exported cluster" placeholder:"BROKER_ADDRESS"`
+	SASLEnabled           bool      `arg:"--publish.sasl.enabled" help:"Enable SASL authentication to the cluster to publish to" default:"false"`
+	SASLUsername          string    `arg:"--publish.sasl.username,env:PUBLISH_SASL_USERNAME" help:"Username for SASL authentication to the cluster to publish to"`
+	SASLPassword          string    `arg:"--publish.sasl.password,env:PUBLISH_SASL_PASSWORD" help:"Password for SASL authentication to the cluster to publish to"`
+	SASLMechanism         string    `arg:"--publish.sasl.mechanism" help:"SASL mechanism to use with the cluster to publish to" default:"PLAIN"`
+	TLSEnabled            bool      `arg:"--publish.tls.enabled" help:"Enable TLS to the cluster to publish to" default:"false"`
+	InsecureSkipTLSVerify bool      `arg:"--publish.tls.insecure-skip-tls-verify" help:"Skip TLS verification of the cluster to publish to" default:"false"`
+}
+
+// kafka returns the connection settings of the cluster to publish to.
+func (p Publish) kafka() Kafka {
+	return Kafka{
+		Servers: p.KafkaServers,
+		SASL: SASL{
+			Enabled:   p.SASLEnabled,
+			Username:  p.SASLUsername,
+			Password:  p.SASLPassword,
+			Mechanism: p.SASLMechanism,
+		},
+		TLS: TLS{
+			Enabled:               p.TLSEnabled,
+			InsecureSkipTLSVerify: p.InsecureSkipTLSVerify,
+		},
+	}
+}
+
+type UI struct {
+	History int `arg:"--ui.history" help:"Number of refreshes of consumer group lag shown in the sparklines of /ui" default:"60"`
+}
+
+type Probe struct {
+	ConfigFile    string        `arg:"--probe.config.file" help:"YAML file of the modules authenticating to the targets of /probe, which is only served with it" placeholder:"FILE"`
+	Timeout       time.Duration `arg:"--probe.timeout" help:"Timeout of a probe when Prometheus doesn't send its scrape timeout" default:"10s" placeholder:"DURATION"`
+	TimeoutOffset time.Duration `arg:"--probe.timeout-offset" help:"Time subtracted from the scrape timeout of Prometheus to leave for the probe result to be sent" default:"500ms" placeholder:"DURATION"`
+	IdleTimeout   time.Duration `arg:"--probe.idle-timeout" help:"Time after which the client of a target that wasn't probed is closed" default:"10m" placeholder:"DURATION"`
+	MaxTargets    int           `arg:"--probe.max-targets" help:"Number of targets whose clients are kept at most, probes of other targets fail until some are idle" default:"100"`
+}
+
+type Metrics struct {
+	Namespace string            `arg:"--metrics.namespace" help:"Namespace prepended to the name of every metric, e.g. acme for acme_kafka_brokers"`
+	Labels    map[string]string `arg:"--metrics.label" help:"Constant label added to every metric, may be repeated" placeholder:"NAME=VALUE"`
+	Compat    Compat            `arg:"--metrics.compat" help:"Export the metrics of another exporter whose names, labels or values differ, replacing ours of the same name, to migrate from it without rewriting dashboards and alerts, danielqsj for danielqsj/kafka_exporter" placeholder:"EXPORTER"`
+}
+
+// metricName matches the valid namespaces and label names of metrics.
+var metricName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// validate reports invalid namespaces and labels, and labels colliding with
+// those of the exported metrics.
+func (m Metrics) validate() error {
+	if m.Namespace != "" && !metricName.MatchString(m.Namespace) {
+		return fmt.Errorf("invalid metrics namespace: %s", m.Namespace)
+	}
+
+	for name := range m.Labels {
+		// labels starting with __ are reserved for Prometheus' own use
+		if !metricName.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid metrics label name: %s", name)
+		}
+	}
+
+	if err := defineMetrics(m).register(prometheus.NewRegistry()); err != nil {
+		return fmt.Errorf("invalid metrics labels: %w", err)
+	}
+	return nil
+}
+
+// prefix returns what is prepended to the name of every metric.
+func (m Metrics) prefix() string {
+	if m.Namespace == "" {
+		return ""
+	}
+	return m.Namespace + "_"
+}
+
+// Compat is an exporter whose metrics are also exported.
+type Compat string
+
+const compatDanielqsj Compat = "danielqsj"
+
+func (c *Compat) UnmarshalText(text []byte) error {
+	switch compat := Compat(text); compat {
+	case "", compatDanielqsj:
+		*c = compat
+		return nil
+	default:
+		return fmt.Errorf("unknown compatibility mode: %s", text)
+	}
+}
+
+type CheckPermissions struct {
+	All bool `arg:"--all" help:"Check every collector, not only the enabled ones" default:"false"`
 }
 
 type TLS struct {
-	Enabled               bool `arg:"--tls.enabled" help:"Enable TLS" default:"false"`
-	InsecureSkipTLSVerify bool `arg:"--tls.insecure-skip-tls-verify" help:"Skip TLS verification" default:"false"`
+	Enabled               bool `arg:"--tls.enabled" help:"Enable TLS" default:"false" yaml:"enabled"`
+	InsecureSkipTLSVerify bool `arg:"--tls.insecure-skip-tls-verify" help:"Skip TLS verification" default:"false" yaml:"insecure_skip_tls_verify"`
 }
 
 func (Config) Description() string {
 	return "Kafka exporter for Prometheus."
 }
 
-func (c Config) Franzgo() *kadm.Client {
-	return kadm.NewClient(franz(c))
+// Franzgo returns the admin client for the configured cluster along with the
+// underlying kgo client, which is used for requests kadm does not wrap. hooks
+// may be nil.
+func (c Config) Franzgo(hooks *clientHooks) (*kadm.Client, *kgo.Client, error) {
+	client, err := franz(c, hooks)
+	if err != nil {
+		return nil, nil, err
+	}
+	return kadm.NewClient(client), client, nil
 }
 
+func franzLogger() kgo.Logger {
+	return kphuslog.New(&log.Logger{Level: log.InfoLevel})
+}
+
+// srvScheme prefixes the addresses whose brokers are looked up from the SRV
+// records of the name that follows.
+const srvScheme = "dns+srv://"
+
 type Address string
 
+// UnmarshalText accepts host:port, with IPv6 hosts in brackets, or
+// dns+srv://name.
 func (s *Address) UnmarshalText(text []byte) error {
-	parts := strings.Split(string(text), ":")
-	if len(parts) != 2 {
-		return fmt.Errorf("invalid server address: %s", text)
+	if name, ok := strings.CutPrefix(string(text), srvScheme); ok {
+		if !validHostname(strings.TrimSuffix(name, ".")) {
+			return fmt.Errorf("invalid srv name: %s", name)
+		}
+
+		*s = Address(text)
+		return nil
 	}
 
-	host := parts[0]
-	port, err := strconv.Atoi(parts[1])
+	host, port, err := net.SplitHostPort(string(text))
 	if err != nil {
-		return fmt.Errorf("invalid port number: %s", parts[1])
+		return fmt.Errorf("invalid server address %s: %w", text, err)
+	}
+
+	number, err := strconv.ParseUint(port, 10, 16)
+	if err != nil || number == 0 {
+		return fmt.Errorf("invalid port number: %s", port)
+	}
+
+	if _, err := netip.ParseAddr(host); err != nil && !validHostname(host) {
+		return fmt.Errorf("invalid host: %s", host)
+	}
+
+	*s = Address(net.JoinHostPort(host, strconv.FormatUint(number, 10)))
+	return nil
+}
+
+// srv returns the name to look the SRV records of up, if the address is a
+// dns+srv one.
+func (s Address) srv() (string, bool) {
+	return strings.CutPrefix(string(s), srvScheme)
+}
+
+// ListenAddress is the address to serve on.
+type ListenAddress string
+
+// UnmarshalText accepts host:port, with an empty host to listen on every
+// interface.
+func (s *ListenAddress) UnmarshalText(text []byte) error {
+	if _, _, err := net.SplitHostPort(string(text)); err != nil {
+		return fmt.Errorf("invalid listen address %s: %w", text, err)
 	}
 
-	*s = Address(fmt.Sprintf("%s:%d", host, port))
+	*s = ListenAddress(text)
 	return nil
 }
 
-func franz(config Config) *kgo.Client {
-	brokers := make([]string, 0, len(config.Servers))
-	for _, server := range config.Servers {
-		brokers = append(brokers, string(server))
+// validHostname reports whether host is made of DNS labels. Underscores are
+// allowed, as they are in SRV names and in the hostnames of many container
+// runtimes.
+func validHostname(host string) bool {
+	if host == "" || len(host) > 253 {
+		return false
+	}
+
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9' || r == '-' || r == '_') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// resolveSeeds returns the seed brokers, looking the dns+srv addresses up
+// every time, so that a re-initialized client picks up the current brokers.
+func resolveSeeds(servers []Address, hooks *clientHooks) []string {
+	seeds := make([]string, 0, len(servers))
+	for _, server := range servers {
+		name, ok := server.srv()
+		if !ok {
+			seeds = append(seeds, string(server))
+			continue
+		}
+
+		_, records, err := net.LookupSRV("", "", name)
+		if hooks != nil {
+			hooks.observeResolution(server, err)
+		}
+		if err != nil {
+			log.Error().Err(err).Str("address", string(server)).Msg("failed to resolve bootstrap servers")
+			continue
+		}
+
+		for _, record := range records {
+			seeds = append(seeds, net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port))))
+		}
+	}
+
+	return seeds
+}
+
+func franz(config Config, hooks *clientHooks) (*kgo.Client, error) {
+	opts, err := franzOpts(config, hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka client: %w", err)
+	}
+
+	if err := client.Ping(context.Background()); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to ping Kafka server: %w", err)
+	}
+
+	return client, nil
+}
+
+// franzOpts returns the options to connect to the configured cluster, shared
+// by every client the exporter creates. hooks may be nil, for clients whose
+// connections are not of interest.
+func franzOpts(config Config, hooks *clientHooks) ([]kgo.Opt, error) {
+	seeds := resolveSeeds(config.Servers, hooks)
+	if len(seeds) == 0 {
+		// kgo would fall back to localhost
+		return nil, errors.New("no bootstrap servers to connect to")
+	}
+
+	var (
+		logger  = franzLogger()
+		observe certificateObserver
+	)
+	if hooks != nil {
+		observe = hooks.observeCertificates
 	}
 
 	opts := []kgo.Opt{
-		kgo.SeedBrokers(brokers...),
-		kgo.WithLogger(kphuslog.New(&log.Logger{Level: log.InfoLevel})),
+		kgo.SeedBrokers(seeds...),
+		kgo.WithLogger(logger),
+	}
+
+	if hooks != nil {
+		opts = append(opts, kgo.WithHooks(hooks))
 	}
 
 	if config.SASL.Enabled {
@@ -101,20 +440,8 @@ func franz(config Config) *kgo.Client {
 	}
 
 	if config.TLS.Enabled {
-		opts = append(opts, kgo.DialTLSConfig(&tls.Config{
-			InsecureSkipVerify: config.TLS.InsecureSkipTLSVerify,
-			ClientAuth:         tls.NoClientCert,
-		}))
-	}
-
-	client, err := kgo.NewClient(opts...)
-	if err != nil {
-		log.Panic().Err(err).Msg("failed to create Kafka client")
-	}
-
-	if err := client.Ping(context.Background()); err != nil {
-		log.Panic().Err(err).Msg("failed to ping Kafka server")
+		opts = append(opts, kgo.Dialer(dialTLS(config.TLS, observe)))
 	}
 
-	return client
+	return opts, nil
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/alexflint/go-arg"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestAddressUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text string
+		want Address
+		err  bool
+	}{
+		{text: "localhost:9092", want: "localhost:9092"},
+		{text: "kafka-0.kafka.svc.cluster.local:9093", want: "kafka-0.kafka.svc.cluster.local:9093"},
+		{text: "10.0.0.1:9092", want: "10.0.0.1:9092"},
+		{text: "[::1]:9092", want: "[::1]:9092"},
+		{text: "[fe80::1%eth0]:9092", want: "[fe80::1%eth0]:9092"},
+		{text: "localhost:09092", want: "localhost:9092"},
+		{text: "dns+srv://_kafka._tcp.example.com", want: "dns+srv://_kafka._tcp.example.com"},
+		{text: "::1:9092", err: true},
+		{text: "localhost", err: true},
+		{text: "localhost:0", err: true},
+		{text: "localhost:65536", err: true},
+		{text: "-kafka:9092", err: true},
+		{text: "kafka..local:9092", err: true},
+		{text: "kafka local:9092", err: true},
+		{text: "dns+srv://", err: true},
+	}
+
+	for _, tt := range tests {
+		var address Address
+		err := address.UnmarshalText([]byte(tt.text))
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected %q to be invalid, got %q", tt.text, address)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected %q to be valid, got %v", tt.text, err)
+		} else if address != tt.want {
+			t.Errorf("expected %q to parse as %q, got %q", tt.text, tt.want, address)
+		}
+	}
+}
+
+func TestListenAddressUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text string
+		err  bool
+	}{
+		{text: ":9308"},
+		{text: "0.0.0.0:9308"},
+		{text: "localhost:9308"},
+		{text: "[::]:9308"},
+		{text: "9308", err: true},
+		{text: "localhost", err: true},
+	}
+
+	for _, tt := range tests {
+		var address ListenAddress
+		err := address.UnmarshalText([]byte(tt.text))
+		if tt.err {
+			if err == nil {
+				t.Errorf("expected %q to be invalid, got %q", tt.text, address)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("expected %q to be valid, got %v", tt.text, err)
+		} else if string(address) != tt.text {
+			t.Errorf("expected %q to parse as itself, got %q", tt.text, address)
+		}
+	}
+}
+
+func TestConfigDefaults(t *testing.T) {
+	var config Config
+	p, err := arg.NewParser(arg.Config{}, &config)
+	if err != nil {
+		t.Fatal(err, "failed to create parser")
+	}
+	if err := p.Parse([]string{"--kafka.servers", "localhost:9092"}); err != nil {
+		t.Fatal("expected the defaults to be valid, got", err)
+	}
+	if config.ListenAddress != ":9308" {
+		t.Errorf("expected to listen on :9308 by default, got %q", config.ListenAddress)
+	}
+}
+
+// testOpts returns the options to connect to the cluster of conf.
+func testOpts(t *testing.T, conf Config) []kgo.Opt {
+	t.Helper()
+
+	opts, err := franzOpts(conf, nil)
+	if err != nil {
+		t.Fatal(err, "failed to resolve bootstrap servers")
+	}
+	return opts
+}
+
+// newTestCluster starts a kfake cluster that is closed once the test is done
+// and returns it along with a config that points at its brokers.
+func newTestCluster(t *testing.T, opts ...kfake.Opt) (*kfake.Cluster, Config) {
+	t.Helper()
+
+	c, err := kfake.NewCluster(opts...)
+	if err != nil {
+		t.Fatal(err, "failed to create cluster")
+	}
+	t.Cleanup(c.Close)
+
+	var conf Config
+	for _, broker := range c.ListenAddrs() {
+		conf.Kafka.Servers = append(conf.Kafka.Servers, Address(broker))
+	}
+	return c, conf
+}
+
+func TestFranzOptsWithoutSeeds(t *testing.T) {
+	// an unresolvable srv name leaves no seed to connect to
+	conf := Config{Kafka: Kafka{Servers: []Address{"dns+srv://_kafka._tcp.invalid"}}}
+	if _, err := franzOpts(conf, nil); err == nil {
+		t.Error("expected an error without bootstrap servers")
+	}
+	if _, _, err := conf.Franzgo(nil); err == nil {
+		t.Error("expected an error without bootstrap servers")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"gopkg.in/yaml.v3"
+)
+
+// anyResource is the name of the desired-state entry that applies to every
+// broker or topic without a more specific entry.
+const anyResource = "*"
+
+// desiredState is the content of the desired-state file, the configs of every
+// broker and topic keyed by broker ID or topic name.
+type desiredState struct {
+	Brokers map[string]map[string]string `yaml:"brokers"`
+	Topics  map[string]map[string]string `yaml:"topics"`
+}
+
+// loadDesiredState reads and validates the desired-state file once at startup.
+func loadDesiredState(path string) (desiredState, error) {
+	var state desiredState
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return state, err
+	}
+
+	// reject unknown keys, a misspelled section would silently detect nothing
+	decoder := yaml.NewDecoder(bytes.NewReader(b))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&state); err != nil && !errors.Is(err, io.EOF) {
+		return state, fmt.Errorf("invalid desired state %s: %w", path, err)
+	}
+
+	return state, nil
+}
+
+// desired returns the desired configs of a resource, its own entry overriding
+// the one of every resource.
+func desired(resources map[string]map[string]string, name string) map[string]string {
+	configs := make(map[string]string)
+	for key, value := range resources[anyResource] {
+		configs[key] = value
+	}
+	for key, value := range resources[name] {
+		configs[key] = value
+	}
+	return configs
+}
+
+// exportDrift exports the dynamic broker configs whose value differs from the
+// majority of brokers and, when a desired-state file is configured, every
+// broker and topic config that differs from it.
+func (e *exporter) exportDrift(ctx context.Context, metadata kadm.Metadata) error {
+	brokers, err := e.client.DescribeBrokerConfigs(ctx, metadata.Brokers.NodeIDs()...)
+	switch {
+	case err == nil:
+	case partialFailure(err):
+		log.Error().Err(err).Msg("failed to describe configs of some brokers")
+		e.onErrors.Record(err)
+	default:
+		return err
+	}
+
+	// the brokers holding each value of a config, for every config that is
+	// dynamically set on at least one broker
+	values := make(map[string]map[string][]string)
+	dynamic := make(map[string]bool)
+	for _, broker := range brokers {
+		if broker.Err != nil {
+			log.Error().Err(broker.Err).Str("broker", broker.Name).Msg("failed to describe broker configs")
+			e.onErrors.Record(broker.Err)
+			continue
+		}
+
+		for _, config := range broker.Configs {
+			if config.Sensitive {
+				continue
+			}
+
+			if values[config.Key] == nil {
+				values[config.Key] = make(map[string][]string)
+			}
+			values[config.Key][config.MaybeValue()] = append(values[config.Key][config.MaybeValue()], broker.Name)
+
+			if config.Source == kmsg.ConfigSourceDynamicBrokerConfig {
+				dynamic[config.Key] = true
+			}
+		}
+	}
+
+	e.metrics.drift.differsFromMajority.Reset()
+	for key := range dynamic {
+		for broker, differs := range differsFromMajority(values[key]) {
+			differing := 0
+			if differs {
+				differing = 1
+			}
+
+			e.metrics.drift.differsFromMajority.With(prometheus.Labels{
+				"id":  broker,
+				"key": key,
+			}).Set(float64(differing))
+		}
+	}
+
+	state := e.desiredState
+	if state == nil {
+		return nil
+	}
+
+	topics := make([]string, 0, len(state.Topics))
+	if _, ok := state.Topics[anyResource]; ok {
+		topics = metadata.Topics.Names()
+	} else {
+		for topic := range state.Topics {
+			if _, ok := metadata.Topics[topic]; !ok {
+				log.Warn().Str("topic", topic).Msg("topic of the desired state does not exist")
+				continue
+			}
+			topics = append(topics, topic)
+		}
+	}
+
+	topicConfigs, err := e.client.DescribeTopicConfigs(ctx, topics...)
+	switch {
+	case err == nil:
+	case partialFailure(err):
+		log.Error().Err(err).Msg("failed to describe configs of some topics")
+		e.onErrors.Record(err)
+	default:
+		return err
+	}
+
+	e.metrics.drift.drift.Reset()
+	e.detectDrift("broker", brokers, state.Brokers)
+	e.detectDrift("topic", topicConfigs, state.Topics)
+
+	return nil
+}
+
+// detectDrift exports the configs of the resources whose value differs from
+// the desired state, or that the resources don't have at all.
+func (e *exporter) detectDrift(resource string, resources kadm.ResourceConfigs, state map[string]map[string]string) {
+	for _, r := range resources {
+		if r.Err != nil {
+			log.Error().Err(r.Err).Str(resource, r.Name).Msgf("failed to describe %s configs", resource)
+			e.onErrors.Record(r.Err)
+			continue
+		}
+
+		actual := make(map[string]kadm.Config, len(r.Configs))
+		for _, config := range r.Configs {
+			actual[config.Key] = config
+		}
+
+		for key, value := range desired(state, r.Name) {
+			config, ok := actual[key]
+			if ok && config.Sensitive {
+				log.Debug().Str(resource, r.Name).Str("key", key).Msg("cannot compare sensitive config to the desired state")
+				continue
+			}
+			if ok && config.MaybeValue() == value {
+				continue
+			}
+
+			log.Debug().
+				Str(resource, r.Name).
+				Str("key", key).
+				Str("desired", value).
+				Str("actual", config.MaybeValue()).
+				Msg("config differs from the desired state")
+
+			e.metrics.drift.drift.With(prometheus.Labels{
+				"resource": resource,
+				"name":     r.Name,
+				"key":      key,
+			}).Set(1)
+		}
+	}
+}
+
+// differsFromMajority reports, for every broker holding one of the values of
+// a config, whether fewer brokers hold its value than the most common one.
+// Brokers tied for the most common value are never reported.
+func differsFromMajority(values map[string][]string) map[string]bool {
+	most := 0
+	for _, brokers := range values {
+		most = max(most, len(brokers))
+	}
+
+	differs := make(map[string]bool)
+	for _, brokers := range values {
+		for _, broker := range brokers {
+			differs[broker] = len(brokers) < most
+		}
+	}
+	return differs
+}
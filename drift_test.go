@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestDiffersFromMajority(t *testing.T) {
+	differs := differsFromMajority(map[string][]string{
+		"168": {"0", "1"},
+		"24":  {"2"},
+	})
+	for broker, want := range map[string]bool{"0": false, "1": false, "2": true} {
+		if differs[broker] != want {
+			t.Errorf("expected broker %s to differ %t, got %t", broker, want, differs[broker])
+		}
+	}
+
+	// without a majority nobody differs from it
+	differs = differsFromMajority(map[string][]string{"168": {"0"}, "24": {"1"}})
+	if differs["0"] || differs["1"] {
+		t.Error("expected tied brokers not to differ from majority")
+	}
+}
+
+func TestExportDrift(t *testing.T) {
+	_, conf := newTestCluster(t, kfake.NumBrokers(3), kfake.SeedTopics(1, "topic2"))
+
+	desiredState := filepath.Join(t.TempDir(), "desired.yaml")
+	if err := os.WriteFile(desiredState, []byte(`
+brokers:
+  "*":
+    log.retention.ms: 1
+topics:
+  topic1:
+    retention.ms: 60000
+  topic2:
+    retention.ms: 60000
+`), 0o644); err != nil {
+		t.Fatal(err, "failed to write desired state")
+	}
+
+	conf.Drift = Drift{Enabled: true, DesiredState: desiredState}
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	ctx := context.Background()
+	retention := "60000"
+	if _, err := e.client.CreateTopic(ctx, 1, 1, map[string]*string{"retention.ms": &retention}, "topic1"); err != nil {
+		t.Fatal(err, "failed to create topic")
+	}
+
+	metadata, err := e.client.Metadata(ctx)
+	if err != nil {
+		t.Fatal(err, "failed to get metadata")
+	}
+
+	if err := e.exportDrift(ctx, metadata); err != nil {
+		t.Fatal(err, "failed to export drift")
+	}
+
+	// every broker and topic2 differ from the desired state, topic1 doesn't
+	if got := testutil.CollectAndCount(e.metrics.drift.drift); got != 4 {
+		t.Fatal("expected 4 drifting configs, got", got)
+	}
+	for _, labels := range []prometheus.Labels{
+		{"resource": "broker", "name": "0", "key": "log.retention.ms"},
+		{"resource": "topic", "name": "topic2", "key": "retention.ms"},
+	} {
+		if got := testutil.ToFloat64(e.metrics.drift.drift.With(labels)); got != 1 {
+			t.Errorf("expected drift for %v, got %v", labels, got)
+		}
+	}
+}
+
+func TestLoadDesiredState(t *testing.T) {
+	for _, tc := range []struct {
+		content string
+		err     bool
+	}{
+		{content: ""},
+		{content: "brokers:\n  \"*\":\n    log.retention.ms: 1\n"},
+		{content: "topic:\n  orders:\n    retention.ms: 1\n", err: true},
+		{content: "brokers: [", err: true},
+	} {
+		path := filepath.Join(t.TempDir(), "desired.yaml")
+		if err := os.WriteFile(path, []byte(tc.content), 0o644); err != nil {
+			t.Fatal(err, "failed to write desired state")
+		}
+		if _, err := loadDesiredState(path); (err != nil) != tc.err {
+			t.Errorf("unexpected error for %q: %v", tc.content, err)
+		}
+	}
+
+	if _, err := loadDesiredState(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing desired state")
+	}
+}
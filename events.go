@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sse"
+	"github.com/phuslu/log"
+)
+
+// names of the events streamed on /events
+const (
+	eventControllerChange      = "controller_change"
+	eventLeaderChange          = "leader_change"
+	eventISRShrink             = "isr_shrink"
+	eventISRExpand             = "isr_expand"
+	eventBrokerJoined          = "broker_joined"
+	eventBrokerLeft            = "broker_left"
+	eventGroupAppeared         = "group_appeared"
+	eventGroupDisappeared      = "group_disappeared"
+	eventGroupRebalancing      = "group_rebalancing"
+	eventLagThresholdExceeded  = "lag_threshold_exceeded"
+	eventLagThresholdRecovered = "lag_threshold_recovered"
+)
+
+// event is a change detected by the collector in between two export cycles.
+type event struct {
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	Broker    *int32    `json:"broker,omitempty"`
+	Topic     string    `json:"topic,omitempty"`
+	Partition *int32    `json:"partition,omitempty"`
+	Group     string    `json:"group,omitempty"`
+	Previous  any       `json:"previous,omitempty"`
+	Current   any       `json:"current,omitempty"`
+}
+
+// lagKey identifies the lag of a consumer group on a single partition.
+type lagKey struct {
+	group     string
+	topic     string
+	partition int32
+}
+
+// rebalancing group states, see kafka.coordinator.group.GroupState
+var rebalancingStates = []string{"PreparingRebalance", "CompletingRebalance"}
+
+func (e *exporter) publish(typ string, ev event) {
+	ev.Type = typ
+	ev.Time = time.Now()
+	e.events.Publish(sse.Event{Name: typ, Data: ev})
+}
+
+// detectGroupChanges publishes the consumer groups that appeared, disappeared
+// or started rebalancing in between two export cycles, given the state of
+// every group.
+func (e *exporter) detectGroupChanges(previous, current map[string]string) {
+	for group, state := range current {
+		previousState, ok := previous[group]
+		if !ok {
+			log.Info().Str("consumergroup", group).Str("state", state).Msg("consumer group appeared")
+			e.publish(eventGroupAppeared, event{Group: group, Current: state})
+			continue
+		}
+
+		if previousState != state && slices.Contains(rebalancingStates, state) && !slices.Contains(rebalancingStates, previousState) {
+			log.Info().Str("consumergroup", group).Str("previous_state", previousState).Str("state", state).Msg("consumer group rebalancing")
+			e.publish(eventGroupRebalancing, event{Group: group, Previous: previousState, Current: state})
+		}
+	}
+
+	for group, state := range previous {
+		if _, ok := current[group]; !ok {
+			log.Info().Str("consumergroup", group).Str("previous_state", state).Msg("consumer group disappeared")
+			e.publish(eventGroupDisappeared, event{Group: group, Previous: state})
+		}
+	}
+}
+
+// detectLagCrossing publishes an event whenever the lag of a group on a
+// partition crosses the configured threshold, in either direction. It returns
+// whether the lag is currently above the threshold.
+func (e *exporter) detectLagCrossing(key lagKey, lag int64, wasAbove bool) bool {
+	threshold := e.config.Events.LagThreshold
+	if threshold <= 0 {
+		return false
+	}
+
+	above := lag > threshold
+	partition := key.partition
+
+	switch {
+	case above && !wasAbove:
+		log.Info().Str("consumergroup", key.group).Str("topic", key.topic).Int32("partition", key.partition).Int64("lag", lag).Msg("consumer group lag exceeded threshold")
+		e.publish(eventLagThresholdExceeded, event{Group: key.group, Topic: key.topic, Partition: &partition, Current: lag})
+	case !above && wasAbove:
+		log.Info().Str("consumergroup", key.group).Str("topic", key.topic).Int32("partition", key.partition).Int64("lag", lag).Msg("consumer group lag recovered below threshold")
+		e.publish(eventLagThresholdRecovered, event{Group: key.group, Topic: key.topic, Partition: &partition, Current: lag})
+	}
+
+	return above
+}
+
+// eventFilter only lets through events matching the topic and group query
+// parameters, either of which can be repeated.
+func eventFilter(r *http.Request) func(sse.Event) bool {
+	topics := r.URL.Query()["topic"]
+	groups := r.URL.Query()["group"]
+
+	return func(se sse.Event) bool {
+		ev, ok := se.Data.(event)
+		if !ok {
+			return false
+		}
+
+		if len(topics) > 0 && !slices.Contains(topics, ev.Topic) {
+			return false
+		}
+
+		return len(groups) == 0 || slices.Contains(groups, ev.Group)
+	}
+}
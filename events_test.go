@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sse"
+)
+
+func TestDetectLagCrossing(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		threshold int64
+		lag       int64
+		wasAbove  bool
+		above     bool
+		event     string
+	}{
+		{name: "disabled", threshold: 0, lag: 100},
+		{name: "stays below", threshold: 10, lag: 5},
+		{name: "at the threshold", threshold: 10, lag: 10},
+		{name: "exceeds", threshold: 10, lag: 11, above: true, event: eventLagThresholdExceeded},
+		{name: "stays above", threshold: 10, lag: 20, wasAbove: true, above: true},
+		{name: "back at the threshold", threshold: 10, lag: 10, wasAbove: true, event: eventLagThresholdRecovered},
+		{name: "recovers", threshold: 10, lag: 0, wasAbove: true, event: eventLagThresholdRecovered},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var published []sse.Event
+			e := &exporter{config: Config{Events: Events{LagThreshold: tc.threshold}}, events: sse.NewHub()}
+			events := subscribe(t, e)
+
+			above := e.detectLagCrossing(lagKey{group: "billing", topic: "orders", partition: 1}, tc.lag, tc.wasAbove)
+			if above != tc.above {
+				t.Errorf("expected above to be %t, got %t", tc.above, above)
+			}
+
+			for len(events) > 0 {
+				published = append(published, <-events)
+			}
+			switch {
+			case tc.event == "" && len(published) > 0:
+				t.Error("expected no event, got", published)
+			case tc.event != "" && (len(published) != 1 || published[0].Name != tc.event):
+				t.Errorf("expected a %s event, got %v", tc.event, published)
+			case tc.event != "":
+				ev := published[0].Data.(event)
+				if ev.Group != "billing" || ev.Topic != "orders" || *ev.Partition != 1 || ev.Current != tc.lag {
+					t.Error("unexpected event", ev)
+				}
+			}
+		})
+	}
+}
+
+func TestDetectGroupChanges(t *testing.T) {
+	e := &exporter{events: sse.NewHub()}
+	events := subscribe(t, e)
+
+	e.detectGroupChanges(
+		map[string]string{"billing": "Stable", "shipping": "Stable", "audit": "PreparingRebalance"},
+		map[string]string{"billing": "PreparingRebalance", "audit": "CompletingRebalance", "invoicing": "Empty"},
+	)
+
+	got := make(map[string]string)
+	for len(events) > 0 {
+		ev := <-events
+		got[ev.Data.(event).Group] = ev.Name
+	}
+
+	expected := map[string]string{
+		"billing":   eventGroupRebalancing,
+		"shipping":  eventGroupDisappeared,
+		"invoicing": eventGroupAppeared,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	for group, name := range expected {
+		if got[group] != name {
+			t.Errorf("expected %s for %s, got %q", name, group, got[group])
+		}
+	}
+}
+
+func TestEventsHandler(t *testing.T) {
+	e := &exporter{config: Config{Events: Events{LagThreshold: 10}}, events: sse.NewHub()}
+	server := httptest.NewServer(e.events.Handler(eventFilter))
+	defer server.Close()
+	defer e.events.Close()
+
+	resp, err := http.Get(server.URL + "/events?topic=orders&group=billing&group=audit")
+	if err != nil {
+		t.Fatal(err, "failed to subscribe")
+	}
+	defer resp.Body.Close()
+
+	e.detectLagCrossing(lagKey{group: "shipping", topic: "orders"}, 20, false)
+	e.detectLagCrossing(lagKey{group: "billing", topic: "payments"}, 20, false)
+	e.detectLagCrossing(lagKey{group: "billing", topic: "orders"}, 20, false)
+
+	r := bufio.NewReader(resp.Body)
+	var name, data string
+	for data == "" {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err, "failed to read the stream")
+		}
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			name = strings.TrimSpace(v)
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = strings.TrimSpace(v)
+		}
+	}
+
+	var ev event
+	if err := json.Unmarshal([]byte(data), &ev); err != nil {
+		t.Fatal(err, "failed to decode event")
+	}
+	if name != eventLagThresholdExceeded || ev.Group != "billing" || ev.Topic != "orders" {
+		t.Errorf("expected only the billing lag on orders to pass the filter, got %s %+v", name, ev)
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	for _, tc := range []struct {
+		query    string
+		ev       event
+		expected bool
+	}{
+		{query: "", ev: event{Topic: "orders"}, expected: true},
+		{query: "topic=orders", ev: event{Topic: "orders"}, expected: true},
+		{query: "topic=orders", ev: event{Topic: "payments"}},
+		{query: "topic=orders&topic=payments", ev: event{Topic: "payments"}, expected: true},
+		{query: "group=billing", ev: event{Group: "billing"}, expected: true},
+		{query: "group=billing", ev: event{Group: "shipping"}},
+		{query: "topic=orders&group=billing", ev: event{Topic: "orders", Group: "shipping"}},
+		// broker events have neither a topic nor a group
+		{query: "topic=orders", ev: event{}},
+	} {
+		accept := eventFilter(httptest.NewRequest(http.MethodGet, "/events?"+tc.query, nil))
+		if got := accept(sse.Event{Data: tc.ev}); got != tc.expected {
+			t.Errorf("expected %t for %q and %+v, got %t", tc.expected, tc.query, tc.ev, got)
+		}
+	}
+}
+
+// subscribe returns the events published by e from now on.
+func subscribe(t *testing.T, e *exporter) <-chan sse.Event {
+	events, unsubscribe := e.events.Subscribe()
+	t.Cleanup(unsubscribe)
+	return events
+}
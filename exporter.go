@@ -1,15 +1,25 @@
 package main
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/0xgirish/kafka-exporter/pkg/fail"
+	"github.com/0xgirish/kafka-exporter/pkg/lagstatus"
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/0xgirish/kafka-exporter/pkg/sse"
 	"github.com/phuslu/log"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
 )
 
 type exporter struct {
@@ -17,37 +27,168 @@ type exporter struct {
 
 	metrics *metrics
 	client  *kadm.Client
+	kafka   *kgo.Client
+	hooks   *clientHooks
 
 	onErrors fail.OnErrors
 
 	config Config
 
 	clientRefreshTime time.Time
+
+	// previous is the metadata seen by the previous export cycle, nil until
+	// the first cycle succeeds
+	previous *kadm.Metadata
+	// quorumLeader is the leader of the metadata quorum seen by the previous
+	// export cycle, -1 when the quorum couldn't be described
+	quorumLeader int32
+	// groups is the state of every consumer group seen by the previous export
+	// cycle, nil until the first cycle succeeds
+	groups map[string]string
+	// lagging tracks the group partitions whose lag is above the lag threshold
+	lagging map[lagKey]bool
+
+	// windows holds the recent samples of every group partition for the
+	// status evaluation
+	windows map[lagKey]*lagstatus.Window
+
+	events *sse.Hub
+	rates  *rates
+
+	// canary is nil unless the canary is enabled
+	canary *canary
+	// desiredState is nil unless a desired-state file is configured
+	desiredState *desiredState
+	// remoteWriter is nil unless remote write endpoints are configured
+	remoteWriter *remoteWriter
+	// sinks are sent the metrics after every export cycle
+	sinks []*sinkQueue
+	// otlp is nil unless an OpenTelemetry collector is configured
+	otlp *otlpPusher
+
+	// snapshot is the state seen by the latest export cycle, nil until the
+	// first one completes
+	snapshot atomic.Pointer[snapshot]
+	// history is the lag of every group over the recent export cycles
+	history *lagHistory
+
+	// disabled holds the collectors the permission self-check found the
+	// exporter isn't authorized to run
+	disabled map[string]bool
 }
 
 func NewExporter(conf Config) *exporter {
-	reg := prometheus.NewRegistry()
+	metrics := newMetrics(prometheus.NewRegistry(), conf.Metrics)
+	hooks := &clientHooks{metrics: metrics.client}
+	client, kafka, err := conf.Franzgo(hooks)
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to connect to Kafka")
+	}
 
-	return &exporter{
+	e := &exporter{
 		d: conf.RefreshInterval,
 
-		metrics: newMetrics(reg),
-		client:  conf.Franzgo(),
+		metrics: metrics,
+		client:  client,
+		kafka:   kafka,
+		hooks:   hooks,
 
 		onErrors:          fail.OnErrors{Max: conf.ContinuousFailures},
 		config:            conf,
 		clientRefreshTime: time.Now(),
+
+		lagging: make(map[lagKey]bool),
+		events:  sse.NewHub(),
+		rates:   newRates(conf.RateWindow),
+		history: newLagHistory(conf.UI.History),
+
+		disabled: make(map[string]bool),
+	}
+
+	if conf.Canary.Enabled {
+		canary, err := newCanary(conf, e.metrics.canary)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to create canary clients")
+		}
+		e.canary = canary
 	}
+
+	if conf.Drift.Enabled && conf.Drift.DesiredState != "" {
+		state, err := loadDesiredState(conf.Drift.DesiredState)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to load desired state")
+		}
+		e.desiredState = &state
+	}
+
+	if len(conf.RemoteWrite.URLs) > 0 {
+		e.remoteWriter = newRemoteWriter(conf.RemoteWrite, e.metrics.remoteWrite)
+		e.sinks = append(e.sinks, newSinkQueue(e.remoteWriter, conf.Sinks.Timeout, e.metrics.sink))
+	}
+	for _, s := range conf.Sinks.sinks() {
+		e.sinks = append(e.sinks, newSinkQueue(s, conf.Sinks.Timeout, e.metrics.sink))
+	}
+
+	if conf.Publish.Topic != "" {
+		publisher, err := newPublisher(conf)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to create publish client")
+		}
+		e.sinks = append(e.sinks, newSinkQueue(publisher, conf.Sinks.Timeout, e.metrics.sink))
+	}
+
+	if conf.OTLP.Endpoint != "" {
+		otlp, err := newOTLPPusher(conf.OTLP, conf.Metrics.prefix(), e.metrics.otlp, e.metrics.reg.Gather)
+		if err != nil {
+			log.Panic().Err(err).Msg("failed to create otlp exporter")
+		}
+		e.otlp = otlp
+	}
+
+	return e
 }
 
 func (e *exporter) Start(ctx context.Context) error {
 	t := time.NewTicker(e.d)
 	defer t.Stop()
 
+	// the background work stops along with Start
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// disable the collectors that would fail every export cycle instead of
+	// crash looping on authorization errors
+	e.disableUnauthorized(ctx)
+
+	if e.canary != nil {
+		go e.canary.run(ctx)
+	}
+
+	if e.remoteWriter != nil {
+		go e.remoteWriter.run(ctx)
+	}
+
+	if e.otlp != nil {
+		go e.otlp.run(ctx)
+	}
+
+	for _, q := range e.sinks {
+		go q.run(ctx)
+	}
+	defer func() {
+		// let the sinks finish the writes in flight before closing them
+		cancel()
+		for _, q := range e.sinks {
+			q.close()
+		}
+	}()
+
 	// don't wait for the first export cycle to complete
 	if err := e.export(ctx); err != nil {
 		e.onErrors.Record(err)
 		log.Error().Err(err).Msg("failed to export metrics")
+	} else {
+		e.writeSinks()
 	}
 
 	for {
@@ -59,8 +200,14 @@ func (e *exporter) Start(ctx context.Context) error {
 
 		if e.onErrors.Failing() && time.Since(e.clientRefreshTime) > 2*time.Minute {
 			log.Warn().Err(e.onErrors.Recent()).Msg("failing, re-initializing client")
-			e.client.Close()
-			e.client = e.config.Franzgo()
+			if client, kafka, err := e.config.Franzgo(e.hooks); err != nil {
+				// keep the current client, it may still recover on its own
+				log.Error().Err(err).Msg("failed to re-initialize client")
+				e.onErrors.Record(err)
+			} else {
+				e.client.Close()
+				e.client, e.kafka = client, kafka
+			}
 			e.clientRefreshTime = time.Now()
 		}
 
@@ -75,10 +222,31 @@ func (e *exporter) Start(ctx context.Context) error {
 			}
 
 			e.onErrors.Record(nil)
+			e.writeSinks()
 		}
 	}
 }
 
+// writeSinks queues the metrics of the last export cycle for every sink.
+func (e *exporter) writeSinks() {
+	if len(e.sinks) == 0 {
+		return
+	}
+
+	families, err := e.metrics.reg.Gather()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to gather metrics for the sinks")
+		return
+	}
+
+	samples := sink.Flatten(families)
+	at := time.Now()
+
+	for _, q := range e.sinks {
+		q.enqueue(samples, at)
+	}
+}
+
 func (e *exporter) export(ctx context.Context) error {
 	defer e.Recover()
 
@@ -87,20 +255,62 @@ func (e *exporter) export(ctx context.Context) error {
 		return err
 	}
 
+	// controller quorum metrics, only available on KRaft clusters
+	quorumLeader := int32(-1)
+	if e.collecting("quorum") {
+		if quorumLeader, err = e.exportQuorum(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to describe quorum")
+			e.onErrors.Record(err)
+		}
+	}
+
+	// change events in between export cycles
+	if e.previous != nil {
+		e.detectChanges(*e.previous, metadata, e.quorumLeader, quorumLeader)
+	}
+	e.previous = &metadata
+	e.quorumLeader = quorumLeader
+
+	// cluster metrics
+	releases, err := e.exportCluster(ctx, metadata)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to get api versions")
+		e.onErrors.Record(err)
+	}
+
 	// broker metrics
 	e.metrics.broker.controller.Set(float64(metadata.Controller))
 	e.metrics.broker.brokers.Set(float64(len(metadata.Brokers)))
+
+	// the version label changes during rolling upgrades
+	e.metrics.broker.brokerInfo.Reset()
+	if d := e.metrics.danielqsj; d != nil {
+		d.brokerInfo.Reset()
+	}
 	for _, broker := range metadata.Brokers {
 		rackID := "unknown"
 		if broker.Rack != nil {
 			rackID = *broker.Rack
 		}
 
+		version, ok := releases[broker.NodeID]
+		if !ok {
+			version = "unknown"
+		}
+
 		e.metrics.broker.brokerInfo.With(prometheus.Labels{
 			"id":      strconv.Itoa(int(broker.NodeID)),
 			"address": fmt.Sprintf("%s:%d", broker.Host, broker.Port),
 			"rack":    rackID,
+			"version": version,
 		}).Set(1)
+
+		if d := e.metrics.danielqsj; d != nil {
+			d.brokerInfo.With(prometheus.Labels{
+				"address": fmt.Sprintf("%s:%d", broker.Host, broker.Port),
+				"id":      strconv.Itoa(int(broker.NodeID)),
+			}).Set(1)
+		}
 	}
 
 	// topic metrics, except for offsets
@@ -135,10 +345,17 @@ func (e *exporter) export(ctx context.Context) error {
 				"partition": strconv.Itoa(int(partition.Partition)),
 			}).Set(float64(len(partition.ISR)))
 
+			if d := e.metrics.danielqsj; d != nil {
+				d.partitionISR.With(prometheus.Labels{
+					"topic":     topic.Topic,
+					"partition": strconv.Itoa(int(partition.Partition)),
+				}).Set(float64(len(partition.ISR)))
+			}
+
 			e.metrics.topic.partitionUnderRep.With(prometheus.Labels{
 				"topic":     topic.Topic,
 				"partition": strconv.Itoa(int(partition.Partition)),
-			}).Set(float64(len(partition.OfflineReplicas)))
+			}).Set(float64(underReplicated(partition, e.config.Metrics.Compat)))
 
 			isPreferred := 0
 			if len(partition.Replicas) > 0 && partition.Leader == partition.Replicas[0] {
@@ -153,50 +370,149 @@ func (e *exporter) export(ctx context.Context) error {
 	}
 
 	// offset metrics
-	offsetsMetrics := func(listOffsets func(ctx context.Context, topics ...string) (kadm.ListedOffsets, error), isEnd bool) {
+	offsetsMetrics := func(listOffsets func(ctx context.Context, topics ...string) (kadm.ListedOffsets, error), metric *prometheus.GaugeVec) kadm.ListedOffsets {
 		topicOffsets, err := listOffsets(ctx, topics...)
 		if err != nil {
-			log.Error().Err(err).Msg("failed to list end offsets")
+			log.Error().Err(err).Msg("failed to list offsets")
 			e.onErrors.Record(err)
-			return
+			return nil
 		}
 
 		for _, offsets := range topicOffsets {
 			for _, offset := range offsets {
 				if offset.Err != nil {
-					log.Error().Err(offset.Err).Msg("failed to get end offset")
+					log.Error().Err(offset.Err).Msg("failed to get offset")
 					e.onErrors.Record(offset.Err)
 					continue
 				}
 
-				metric := e.metrics.topic.partitionOldestOffset
-				if isEnd {
-					metric = e.metrics.topic.partitionCurrentOffset
-				}
-
 				metric.With(prometheus.Labels{
 					"topic":     offset.Topic,
 					"partition": strconv.Itoa(int(offset.Partition)),
 				}).Set(float64(offset.Offset))
 			}
 		}
+
+		return topicOffsets
+	}
+
+	endOffsets := offsetsMetrics(e.client.ListEndOffsets, e.metrics.topic.partitionCurrentOffset)
+	listedAt := time.Now()
+	endOffsets.Each(func(offset kadm.ListedOffset) {
+		if offset.Err == nil {
+			e.observeProduce(partitionKey{topic: offset.Topic, partition: offset.Partition}, offset.Offset, listedAt)
+		}
+	})
+
+	startOffsets := offsetsMetrics(e.client.ListStartOffsets, e.metrics.topic.partitionOldestOffset)
+
+	// served by the api, with the groups added by exportGroups
+	snap := newSnapshot(metadata, startOffsets, endOffsets, listedAt)
+	defer e.storeSnapshot(snap)
+
+	// read_committed consumers can only read up to the last stable offset,
+	// which lags behind the end offset while transactions are open
+	stableOffsets := offsetsMetrics(e.client.ListCommittedOffsets, e.metrics.topic.partitionLastStableOffset)
+
+	// producer and transaction state metrics
+	if e.config.Transactions.Enabled && e.collecting("transactions") {
+		if err := e.exportTransactions(ctx, metadata); err != nil {
+			log.Error().Err(err).Msg("failed to describe transactions")
+			e.onErrors.Record(err)
+		}
 	}
 
-	offsetsMetrics(e.client.ListEndOffsets, true)
-	offsetsMetrics(e.client.ListStartOffsets, false)
+	// client quota and scram credential metrics
+	if e.config.Quotas.Enabled && e.collecting("quotas") {
+		if err := e.exportQuotas(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to describe quotas")
+			e.onErrors.Record(err)
+		}
+	}
+
+	// acl metrics
+	if e.config.ACLs.Enabled && e.collecting("acls") {
+		if err := e.exportACLs(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to describe acls")
+			e.onErrors.Record(err)
+		}
+	}
+
+	// config drift metrics
+	if e.config.Drift.Enabled && e.collecting("drift") {
+		if err := e.exportDrift(ctx, metadata); err != nil {
+			log.Error().Err(err).Msg("failed to detect config drift")
+			e.onErrors.Record(err)
+		}
+	}
 
 	// consumer group metrics
+	if e.collecting("groups") {
+		if err := e.exportGroups(ctx, stableOffsets, snap); err != nil {
+			return err
+		}
+	}
+
+	e.sweepRates(endOffsets != nil)
+
+	return nil
+}
+
+// underReplicated returns the value of the under replicated metric of a
+// partition: its number of offline replicas, or whether it has fewer in-sync
+// replicas than replicas as danielqsj/kafka_exporter has it.
+func underReplicated(partition kadm.PartitionDetail, compat Compat) int {
+	if compat == compatDanielqsj {
+		if len(partition.ISR) < len(partition.Replicas) {
+			return 1
+		}
+		return 0
+	}
+	return len(partition.OfflineReplicas)
+}
+
+// exportGroups exports the lag, offsets, rates and status of every consumer
+// group, adds them to the snapshot, and streams the group events since the
+// previous export cycle.
+func (e *exporter) exportGroups(ctx context.Context, stableOffsets kadm.ListedOffsets, snap *snapshot) error {
 	groupLags, err := e.client.Lag(ctx)
 	if err != nil {
 		log.Error().Err(err).Msg("failed to get consumer group lags")
+		// the cycle ends before the rates are swept
+		e.rates.clearSeen()
 		return err
 	}
+	lagAt := time.Now()
 
+	groups := make(map[string]string, len(groupLags))
+	lagging := make(map[lagKey]bool, len(e.lagging))
+	windows := make(map[lagKey]*lagstatus.Window, len(e.windows))
+	snap.groups = make(map[string]groupSnapshot, len(groupLags))
 	for _, groupLag := range groupLags {
+		if groupLag.DescribeErr == nil {
+			groups[groupLag.Group] = groupLag.State
+		} else if state, ok := e.groups[groupLag.Group]; ok {
+			// don't report a group as gone only because it couldn't be described
+			groups[groupLag.Group] = state
+		}
+
 		if groupLag.FetchErr != nil || groupLag.DescribeErr != nil {
 			e.onErrors.Record(groupLag.FetchErr)
 			e.onErrors.Record(groupLag.DescribeErr)
 
+			// keep evaluating the group from where it left off once it recovers
+			for key, window := range e.windows {
+				if key.group == groupLag.Group {
+					windows[key] = window
+				}
+			}
+			e.keepConsumeRates(groupLag.Group)
+			if previous := e.snapshot.Load(); previous != nil {
+				if group, ok := previous.groups[groupLag.Group]; ok {
+					snap.groups[groupLag.Group] = group
+				}
+			}
+
 			log.Error().
 				AnErr("fetch_err", groupLag.FetchErr).
 				AnErr("describe_err", groupLag.DescribeErr).
@@ -212,11 +528,41 @@ func (e *exporter) export(ctx context.Context) error {
 			"consumergroup": groupLag.Group,
 		}).Set(float64(groupLag.Coordinator.NodeID))
 
+		group := groupSnapshot{
+			Name:        groupLag.Group,
+			State:       groupLag.State,
+			Status:      lagstatus.OK.String(),
+			Coordinator: groupLag.Coordinator.NodeID,
+			Members:     make([]memberSnapshot, 0, len(groupLag.Members)),
+			Partitions:  []groupPartitionSnapshot{},
+			UpdatedAt:   lagAt,
+		}
+		for _, member := range groupLag.Members {
+			group.Members = append(group.Members, memberSnapshot{
+				ID:         member.MemberID,
+				InstanceID: member.InstanceID,
+				ClientID:   member.ClientID,
+				Host:       member.ClientHost,
+			})
+		}
+		snap.groups[groupLag.Group] = group
+
 		if len(groupLag.Lag) == 0 {
 			log.Warn().Str("consumergroup", groupLag.Group).Msg("no lag information found for consumer group")
 			continue
 		}
 
+		// the group catches up once its slowest partition does
+		catchUp, catchUpKnown := 0.0, false
+		status := lagstatus.OK
+
+		// lag is computed against the end offset unless the group is configured
+		// to consume with read_committed isolation
+		readCommitted := e.config.ReadCommittedGroups != nil && e.config.ReadCommittedGroups.MatchString(groupLag.Group)
+
+		// per topic sums of the danielqsj/kafka_exporter metrics
+		lagSums, offsetSums := make(map[string]int64), make(map[string]int64)
+
 		for _, memberLags := range groupLag.Lag {
 			for _, memberLag := range memberLags {
 				if memberLag.Err != nil {
@@ -225,11 +571,38 @@ func (e *exporter) export(ctx context.Context) error {
 					continue
 				}
 
+				if readCommitted && memberLag.Commit.At != -1 {
+					if stable, ok := stableOffsets.Lookup(memberLag.Topic, memberLag.Partition); ok && stable.Err == nil {
+						memberLag.Lag = max(0, stable.Offset-memberLag.Commit.At)
+					}
+				}
+
 				e.metrics.group.lag.With(prometheus.Labels{
 					"consumergroup": groupLag.Group,
 					"topic":         memberLag.Topic,
 					"partition":     strconv.Itoa(int(memberLag.Partition)),
 				}).Set(float64(memberLag.Lag))
+				lagSums[memberLag.Topic] += memberLag.Lag
+
+				partition := groupPartitionSnapshot{
+					Topic:     memberLag.Topic,
+					Partition: memberLag.Partition,
+					EndOffset: memberLag.End.Offset,
+					Lag:       memberLag.Lag,
+				}
+				if memberLag.Commit.At != -1 {
+					partition.Offset = &memberLag.Commit.At
+				}
+				if memberLag.Member != nil {
+					partition.Member = memberLag.Member.MemberID
+				}
+				group.Partitions = append(group.Partitions, partition)
+				group.Lag += memberLag.Lag
+
+				key := lagKey{group: groupLag.Group, topic: memberLag.Topic, partition: memberLag.Partition}
+				if e.detectLagCrossing(key, memberLag.Lag, e.lagging[key]) {
+					lagging[key] = true
+				}
 
 				if memberLag.Commit.At != -1 {
 					e.metrics.group.currentOffset.With(prometheus.Labels{
@@ -237,10 +610,52 @@ func (e *exporter) export(ctx context.Context) error {
 						"topic":         memberLag.Topic,
 						"partition":     strconv.Itoa(int(memberLag.Partition)),
 					}).Set(float64(memberLag.Commit.At))
+					offsetSums[memberLag.Topic] += memberLag.Commit.At
+
+					if seconds, ok := e.observeConsume(key, memberLag.Commit.At, memberLag.Lag, lagAt); ok {
+						catchUp, catchUpKnown = max(catchUp, seconds), true
+					}
+
+					status = max(status, e.evaluateStatus(windows, key, lagstatus.Sample{
+						Offset: memberLag.Commit.At,
+						Lag:    memberLag.Lag,
+						Active: !memberLag.IsEmpty(),
+					}))
 				}
 			}
 		}
+
+		if catchUpKnown {
+			e.metrics.group.catchUp.With(prometheus.Labels{
+				"consumergroup": groupLag.Group,
+			}).Set(catchUp)
+		}
+
+		e.metrics.group.status.With(prometheus.Labels{
+			"consumergroup": groupLag.Group,
+		}).Set(float64(status))
+
+		if d := e.metrics.danielqsj; d != nil {
+			for topic, lag := range lagSums {
+				labels := prometheus.Labels{"consumergroup": groupLag.Group, "topic": topic}
+				d.lagSum.With(labels).Set(float64(lag))
+				d.currentOffsetSum.With(labels).Set(float64(offsetSums[topic]))
+			}
+		}
+
+		slices.SortFunc(group.Partitions, func(a, b groupPartitionSnapshot) int {
+			return cmp.Or(strings.Compare(a.Topic, b.Topic), cmp.Compare(a.Partition, b.Partition))
+		})
+		group.Status = status.String()
+		snap.groups[groupLag.Group] = group
+	}
+
+	if e.groups != nil {
+		e.detectGroupChanges(e.groups, groups)
 	}
+	e.groups = groups
+	e.lagging = lagging
+	e.windows = windows
 
 	return nil
 }
@@ -251,3 +666,20 @@ func (e *exporter) Recover() {
 		log.Error().Stack().Msgf("Recovered from panic: %v", r)
 	}
 }
+
+// unsupported reports whether err means that the brokers can't handle a
+// request at all, e.g. KRaft only requests against a ZooKeeper based cluster.
+func unsupported(err error) bool {
+	// kgo doesn't export the errors it returns when a broker didn't advertise
+	// the request key in its ApiVersions response
+	return errors.Is(err, kerr.UnsupportedVersion) ||
+		strings.Contains(err.Error(), "broker is too old") ||
+		strings.Contains(err.Error(), "request key is unknown")
+}
+
+// partialFailure reports whether err is a *kadm.ShardErrors of a request that
+// still succeeded on some brokers, in which case the response is usable.
+func partialFailure(err error) bool {
+	var se *kadm.ShardErrors
+	return errors.As(err, &se) && !se.AllFailed
+}
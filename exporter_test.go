@@ -3,14 +3,17 @@ package main
 import (
 	"context"
 	"net/http/httptest"
+	"regexp"
 	"testing"
 	"time"
 
 	"github.com/phuslu/log"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/twmb/franz-go/pkg/kadm"
 	"github.com/twmb/franz-go/pkg/kfake"
 	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
 	"github.com/twmb/franz-go/plugin/kphuslog"
 )
 
@@ -22,25 +25,14 @@ func TestCollector(t *testing.T) {
 
 	numBrokers := 3
 
-	c, err := kfake.NewCluster(
+	_, conf := newTestCluster(t,
 		kfake.NumBrokers(numBrokers),
 		kfake.DefaultNumPartitions(3),
 		kfake.SeedTopics(0, "topic1", "topic2"),
 	)
 
-	if err != nil {
-		t.Fatal(err, "failed to create cluster")
-	}
-
-	defer c.Close()
-
-	var conf Config
-	for _, broker := range c.ListenAddrs() {
-		conf.Kafka.Servers = append(conf.Kafka.Servers, Address(broker))
-	}
-
 	client, err := kgo.NewClient(append(
-		franz(conf).Opts(),
+		testOpts(t, conf),
 		kgo.ConsumerGroup("dummy-cg"),
 		kgo.ConsumeTopics("topic1"),
 		kgo.WithLogger(kphuslog.New(&log.Logger{Level: log.ErrorLevel})),
@@ -97,12 +89,26 @@ func TestCollector(t *testing.T) {
 		t.Fatal("no metrics found")
 	}
 
+	var clusterInfoFound bool
 	for _, mf := range metricFamily {
 		if *mf.Name == "kafka_brokers" {
 			if mf.Metric[0].Gauge.GetValue() != float64(numBrokers) {
 				t.Fatal("expected 3 brokers, got", mf.Metric[0].Gauge.GetValue())
 			}
 		}
+
+		if *mf.Name == "kafka_cluster_info" {
+			clusterInfoFound = true
+			for _, label := range mf.Metric[0].Label {
+				if label.GetName() == "cluster_id" && label.GetValue() != "kfake" {
+					t.Fatal("expected cluster id kfake, got", label.GetValue())
+				}
+			}
+		}
+	}
+
+	if !clusterInfoFound {
+		t.Fatal("expected kafka_cluster_info to be exported")
 	}
 
 	trw, treq := httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil)
@@ -110,3 +116,95 @@ func TestCollector(t *testing.T) {
 
 	t.Log(trw.Body.String())
 }
+
+func TestReadCommittedLag(t *testing.T) {
+	c, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+
+	// kfake doesn't implement transactions, so keep the last stable offset at
+	// 2 as if a transaction was still open on the last record
+	c.ControlKey(int16(kmsg.ListOffsets), func(req kmsg.Request) (kmsg.Response, error, bool) {
+		c.KeepControl()
+
+		list := req.(*kmsg.ListOffsetsRequest)
+		if list.IsolationLevel != 1 {
+			return nil, nil, false
+		}
+
+		resp := list.ResponseKind().(*kmsg.ListOffsetsResponse)
+		for _, rt := range list.Topics {
+			st := kmsg.NewListOffsetsResponseTopic()
+			st.Topic = rt.Topic
+			for _, rp := range rt.Partitions {
+				sp := kmsg.NewListOffsetsResponseTopicPartition()
+				sp.Partition = rp.Partition
+				sp.Offset = 2
+				sp.Timestamp = -1
+				sp.LeaderEpoch = -1
+				st.Partitions = append(st.Partitions, sp)
+			}
+			resp.Topics = append(resp.Topics, st)
+		}
+		return resp, nil, true
+	})
+	conf.ReadCommittedGroups = regexp.MustCompile("^billing$")
+
+	ctx := context.Background()
+	producer, err := franz(conf, nil)
+	if err != nil {
+		t.Fatal(err, "failed to create producer")
+	}
+	defer producer.Close()
+	for _, value := range []string{"a", "b", "c"} {
+		if err := producer.ProduceSync(ctx, &kgo.Record{Topic: "orders", Value: []byte(value)}).FirstErr(); err != nil {
+			t.Fatal(err, "failed to produce")
+		}
+	}
+
+	// both groups committed the first record
+	for _, group := range []string{"billing", "shipping"} {
+		consumer, err := kgo.NewClient(append(
+			testOpts(t, conf),
+			kgo.ConsumerGroup(group),
+			kgo.ConsumeTopics("orders"),
+			kgo.WithLogger(kphuslog.New(&log.Logger{Level: log.ErrorLevel})),
+		)...)
+		if err != nil {
+			t.Fatal(err, "failed to create client")
+		}
+		defer consumer.Close()
+
+		if err := consumer.PollFetches(ctx).Err(); err != nil {
+			t.Fatal(err, "failed to poll")
+		}
+
+		var commitErr error
+		consumer.CommitOffsetsSync(ctx, map[string]map[int32]kgo.EpochOffset{
+			"orders": {0: {Epoch: -1, Offset: 1}},
+		}, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+			commitErr = err
+		})
+		if commitErr != nil {
+			t.Fatal(commitErr, "failed to commit")
+		}
+	}
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+	if err := e.export(ctx); err != nil {
+		t.Fatal(err, "failed to export")
+	}
+
+	for group, expected := range map[string]float64{
+		// against the last stable offset
+		"billing": 1,
+		// against the end offset
+		"shipping": 2,
+	} {
+		if lag := testutil.ToFloat64(e.metrics.group.lag.WithLabelValues(group, "orders", "0")); lag != expected {
+			t.Errorf("expected a lag of %v for %s, got %v", expected, group, lag)
+		}
+	}
+	if lso := testutil.ToFloat64(e.metrics.topic.partitionLastStableOffset.WithLabelValues("orders", "0")); lso != 2 {
+		t.Error("expected a last stable offset of 2, got", lso)
+	}
+}
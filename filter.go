@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// scrapeFilter selects the slice of the metrics a scrape asks for with the
+// collect[], topic and group query parameters of /metrics.
+type scrapeFilter struct {
+	// collections are the names of the collections to gather, every one if
+	// empty
+	collections []string
+	// labels holds the patterns the values of the labels must fully match,
+	// metrics without the label are kept
+	labels map[string]*regexp.Regexp
+}
+
+// filterLabels maps the query parameters filtering on label values to the
+// label they filter on.
+var filterLabels = map[string]string{
+	"topic": "topic",
+	"group": "consumergroup",
+}
+
+func parseScrapeFilter(query url.Values, m *metrics) (*scrapeFilter, error) {
+	f := &scrapeFilter{labels: make(map[string]*regexp.Regexp)}
+
+	for _, name := range query["collect[]"] {
+		if _, ok := m.collections[name]; !ok {
+			return nil, fmt.Errorf("unknown collection %s, expected one of %s", name, strings.Join(collectionNames(m), ", "))
+		}
+		if !slices.Contains(f.collections, name) {
+			f.collections = append(f.collections, name)
+		}
+	}
+
+	for param, label := range filterLabels {
+		if !query.Has(param) {
+			continue
+		}
+
+		pattern, err := regexp.Compile("^(?:" + query.Get(param) + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s pattern: %w", param, err)
+		}
+		f.labels[label] = pattern
+	}
+
+	return f, nil
+}
+
+func collectionNames(m *metrics) []string {
+	names := make([]string, 0, len(m.collections))
+	for name := range m.collections {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// gather returns the metric families of m the filter selects.
+func (f *scrapeFilter) gather(m *metrics) ([]*dto.MetricFamily, error) {
+	gatherer := prometheus.Gatherer(m.reg)
+	if len(f.collections) > 0 {
+		// the collectors stay registered with m.reg, a collector can be
+		// registered with any number of registries
+		reg := prometheus.NewRegistry()
+		wrapped := m.registerer(reg)
+		for _, name := range f.collections {
+			for _, collector := range m.collections[name] {
+				if err := wrapped.Register(collector); err != nil {
+					return nil, err
+				}
+			}
+		}
+		gatherer = reg
+	}
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		return nil, err
+	}
+	if len(f.labels) == 0 {
+		return families, nil
+	}
+
+	filtered := families[:0]
+	for _, family := range families {
+		family.Metric = slices.DeleteFunc(family.Metric, func(metric *dto.Metric) bool {
+			return !f.match(metric)
+		})
+		if len(family.Metric) > 0 {
+			filtered = append(filtered, family)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (f *scrapeFilter) match(metric *dto.Metric) bool {
+	for _, label := range metric.GetLabel() {
+		if pattern, ok := f.labels[label.GetName()]; ok && !pattern.MatchString(label.GetValue()) {
+			return false
+		}
+	}
+	return true
+}
+
+// metricsHandler serves the metrics, only the slice selected by the query
+// parameters if any.
+func (e *exporter) metricsHandler() http.Handler {
+	unfiltered := promhttp.HandlerFor(e.metrics.reg, promhttp.HandlerOpts{Registry: e.metrics.reg})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if !query.Has("collect[]") && !query.Has("topic") && !query.Has("group") {
+			unfiltered.ServeHTTP(w, r)
+			return
+		}
+
+		filter, err := parseScrapeFilter(query, e.metrics)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) {
+			return filter.gather(e.metrics)
+		})
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
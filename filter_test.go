@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestMetricsFilter(t *testing.T) {
+	e := &exporter{metrics: newMetrics(prometheus.NewRegistry(), Metrics{})}
+	e.metrics.broker.brokers.Set(3)
+	for _, topic := range []string{"billing.invoices", "shipping.parcels"} {
+		e.metrics.topic.partitions.WithLabelValues(topic).Set(1)
+	}
+	for _, group := range []string{"billing", "shipping"} {
+		e.metrics.group.members.WithLabelValues(group).Set(1)
+		e.metrics.group.lag.WithLabelValues(group, "billing.invoices", "0").Set(5)
+	}
+
+	handler := e.metricsHandler()
+
+	for _, tc := range []struct {
+		name     string
+		query    string
+		code     int
+		expected []string
+		excluded []string
+	}{
+		{
+			name:     "unfiltered",
+			code:     http.StatusOK,
+			expected: []string{"kafka_brokers 3", `topic="shipping.parcels"`, `consumergroup="shipping"`},
+		},
+		{
+			name:     "collection",
+			query:    "collect[]=groups",
+			code:     http.StatusOK,
+			expected: []string{`kafka_consumergroup_members{consumergroup="billing"} 1`},
+			excluded: []string{"kafka_brokers", "kafka_topic_partitions"},
+		},
+		{
+			name:     "collections",
+			query:    "collect[]=groups&collect[]=brokers&collect[]=groups",
+			code:     http.StatusOK,
+			expected: []string{"kafka_consumergroup_members", "kafka_brokers 3"},
+			excluded: []string{"kafka_topic_partitions"},
+		},
+		{
+			name:     "topic",
+			query:    "topic=billing\\..*",
+			code:     http.StatusOK,
+			expected: []string{`kafka_topic_partitions{topic="billing.invoices"} 1`, "kafka_brokers 3", `consumergroup="shipping"`},
+			excluded: []string{"shipping.parcels"},
+		},
+		{
+			name:     "group",
+			query:    "collect[]=groups&group=bill",
+			code:     http.StatusOK,
+			excluded: []string{"kafka_consumergroup_members", "kafka_consumergroup_lag"},
+		},
+		{
+			name:  "unknown collection",
+			query: "collect[]=partitions",
+			code:  http.StatusBadRequest,
+		},
+		{
+			name:  "invalid pattern",
+			query: "topic=(",
+			code:  http.StatusBadRequest,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics?"+tc.query, nil))
+			if w.Code != tc.code {
+				t.Fatalf("expected %d, got %d: %s", tc.code, w.Code, w.Body.String())
+			}
+
+			body := w.Body.String()
+			for _, s := range tc.expected {
+				if !strings.Contains(body, s) {
+					t.Errorf("expected %q in the metrics", s)
+				}
+			}
+			for _, s := range tc.excluded {
+				if strings.Contains(body, s) {
+					t.Errorf("expected no %q in the metrics", s)
+				}
+			}
+		})
+	}
+}
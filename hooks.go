@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// clientHooks exports how the brokers behave from the point of view of the
+// exporter's client, labeled by broker node ID, or seed_N before the client
+// knows the ID of a seed broker.
+type clientHooks struct {
+	metrics clientMetrics
+}
+
+var (
+	_ kgo.HookBrokerConnect  = (*clientHooks)(nil)
+	_ kgo.HookBrokerWrite    = (*clientHooks)(nil)
+	_ kgo.HookBrokerRead     = (*clientHooks)(nil)
+	_ kgo.HookBrokerE2E      = (*clientHooks)(nil)
+	_ kgo.HookBrokerThrottle = (*clientHooks)(nil)
+)
+
+func (h *clientHooks) OnBrokerConnect(meta kgo.BrokerMetadata, dialDur time.Duration, _ net.Conn, err error) {
+	id := kgo.NodeName(meta.NodeID)
+	if err != nil {
+		h.metrics.connectErrors.With(prometheus.Labels{"id": id}).Inc()
+		return
+	}
+	h.metrics.connectLatency.With(prometheus.Labels{"id": id}).Observe(dialDur.Seconds())
+}
+
+func (h *clientHooks) OnBrokerWrite(meta kgo.BrokerMetadata, _ int16, bytesWritten int, _, _ time.Duration, _ error) {
+	h.metrics.writtenBytes.With(prometheus.Labels{"id": kgo.NodeName(meta.NodeID)}).Add(float64(bytesWritten))
+}
+
+func (h *clientHooks) OnBrokerRead(meta kgo.BrokerMetadata, _ int16, bytesRead int, _, _ time.Duration, _ error) {
+	h.metrics.readBytes.With(prometheus.Labels{"id": kgo.NodeName(meta.NodeID)}).Add(float64(bytesRead))
+}
+
+func (h *clientHooks) OnBrokerE2E(meta kgo.BrokerMetadata, key int16, e2e kgo.BrokerE2E) {
+	labels := prometheus.Labels{
+		"id":  kgo.NodeName(meta.NodeID),
+		"api": kmsg.NameForKey(key),
+	}
+
+	if err := e2e.Err(); err != nil {
+		h.metrics.requestErrors.With(labels).Inc()
+		// brokers close the connection on credentials they reject, failing
+		// the authentication round trip
+		if key == int16(kmsg.SASLAuthenticate) {
+			h.metrics.saslFailures.With(prometheus.Labels{"id": labels["id"]}).Inc()
+		}
+		return
+	}
+	h.metrics.requestLatency.With(labels).Observe(e2e.DurationE2E().Seconds())
+}
+
+func (h *clientHooks) OnBrokerThrottle(meta kgo.BrokerMetadata, throttleInterval time.Duration, _ bool) {
+	h.metrics.throttle.With(prometheus.Labels{"id": kgo.NodeName(meta.NodeID)}).Observe(throttleInterval.Seconds())
+}
+
+// observeResolution counts the failures to look the brokers of a dns+srv
+// address up.
+func (h *clientHooks) observeResolution(address Address, err error) {
+	failures := h.metrics.resolutionFailures.With(prometheus.Labels{"address": string(address)})
+	if err != nil {
+		failures.Inc()
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestClientHooks(t *testing.T) {
+	_, conf := newTestCluster(t,
+		kfake.NumBrokers(1),
+		kfake.EnableSASL(),
+		kfake.Superuser("PLAIN", "admin", "admin"),
+	)
+
+	conf.Kafka.SASL = SASL{Enabled: true, Mechanism: "PLAIN", Username: "admin", Password: "admin"}
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	for name, metric := range map[string]prometheus.Collector{
+		"connect latency": e.metrics.client.connectLatency,
+		"written bytes":   e.metrics.client.writtenBytes,
+		"read bytes":      e.metrics.client.readBytes,
+		"request latency": e.metrics.client.requestLatency,
+	} {
+		if testutil.CollectAndCount(metric) == 0 {
+			t.Errorf("expected %s to be observed while pinging the cluster", name)
+		}
+	}
+
+	// kfake drops the connection on wrong credentials
+	conf.Kafka.SASL.Password = "wrong"
+	opts, err := franzOpts(conf, e.hooks)
+	if err != nil {
+		t.Fatal(err, "failed to resolve bootstrap servers")
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	if err := client.Ping(context.Background()); err == nil {
+		t.Fatal("expected the ping with wrong credentials to fail")
+	}
+	if got := testutil.ToFloat64(e.metrics.client.saslFailures.With(prometheus.Labels{"id": "seed_0"})); got < 1 {
+		t.Fatal("expected a sasl authentication failure, got", got)
+	}
+}
@@ -4,12 +4,12 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"os"
 	"time"
 
 	"github.com/0xgirish/kafka-exporter/pkg/sighandler"
 	"github.com/alexflint/go-arg"
 	"github.com/phuslu/log"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 func main() {
@@ -23,7 +23,10 @@ func main() {
 	}()
 
 	var config Config
-	arg.MustParse(&config)
+	p := arg.MustParse(&config)
+	if err := config.Metrics.validate(); err != nil {
+		p.Fail(err.Error())
+	}
 
 	switch config.LogLevel {
 	case "debug":
@@ -38,21 +41,69 @@ func main() {
 		log.DefaultLogger.SetLevel(log.DebugLevel)
 	}
 
+	web := &webConfig{}
+	if config.WebConfigFile != "" {
+		var err error
+		if web, err = loadWebConfig(config.WebConfigFile); err != nil {
+			log.Panic().Err(err).Msg("failed to load web config")
+		}
+	}
+
+	tlsConfig, err := web.tlsConfig()
+	if err != nil {
+		log.Panic().Err(err).Msg("failed to configure web tls")
+	}
+
+	// probing is opt-in, it connects to any cluster a client asks for
+	var prober *prober
+	if config.Probe.ConfigFile != "" {
+		if prober, err = newProber(config); err != nil {
+			log.Panic().Err(err).Msg("failed to load probe config")
+		}
+	}
+
 	ctx := sighandler.WithCancelOnSigInt(context.Background())
 	exporter := NewExporter(config)
 
+	if config.CheckPermissions != nil {
+		permissions := exporter.checkPermissions(ctx, config.CheckPermissions.All)
+		exporter.client.Close()
+		if !printPermissions(os.Stdout, permissions) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	server := &http.Server{
 		Addr: string(config.ListenAddress),
 		Handler: func() http.Handler {
 			mux := http.NewServeMux()
-			mux.Handle("/metrics",
-				promhttp.HandlerFor(exporter.metrics.reg, promhttp.HandlerOpts{Registry: exporter.metrics.reg}))
-			return mux
+			mux.Handle("/metrics", exporter.metricsHandler())
+			mux.Handle("/events", exporter.events.Handler(eventFilter))
+			mux.Handle("/api/v1/", exporter.apiHandler())
+			mux.Handle("/ui", exporter.uiHandler())
+			if prober != nil {
+				mux.Handle("/probe", prober)
+			}
+			mux.HandleFunc(healthPath, func(w http.ResponseWriter, _ *http.Request) {
+				_, _ = w.Write([]byte("OK"))
+			})
+			return web.protect(mux)
 		}(),
+		TLSConfig: tlsConfig,
 	}
 
+	// event streams never finish on their own, end them so shutdown doesn't time out
+	server.RegisterOnShutdown(exporter.events.Close)
+
 	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		serve := server.ListenAndServe
+		if tlsConfig != nil {
+			// the certificate comes from the tls config
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+
+		if err := serve(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			log.Panic().Err(err).Msg("failed to start server")
 		}
 	}()
@@ -1,17 +1,69 @@
 package main
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"slices"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 type metrics struct {
-	broker brokerMetrics
-	topic  topicMetrics
-	group  consumerGroupMetrics
+	cluster clusterMetrics
+	broker  brokerMetrics
+	topic   topicMetrics
+	group   consumerGroupMetrics
+	quorum  quorumMetrics
+	changes changeMetrics
+
+	transaction transactionMetrics
+	quota       quotaMetrics
+	acl         aclMetrics
+	permission  permissionMetrics
+	drift       driftMetrics
+	canary      canaryMetrics
+	client      clientMetrics
+	remoteWrite remoteWriteMetrics
+	otlp        otlpMetrics
+	sink        sinkMetrics
+
+	// danielqsj is nil unless the danielqsj/kafka_exporter metrics are also
+	// exported
+	danielqsj *danielqsjMetrics
+
+	// collections are the metrics registered with reg by name
+	collections map[string][]prometheus.Collector
 
-	reg *prometheus.Registry
+	conf Metrics
+	reg  *prometheus.Registry
 }
 
-func newMetrics(reg *prometheus.Registry) *metrics {
+func newMetrics(reg *prometheus.Registry, conf Metrics) *metrics {
+	m := defineMetrics(conf)
+	m.reg = reg
+	if err := m.register(reg); err != nil {
+		// the metrics configuration is validated when parsed
+		panic(err)
+	}
+	return m
+}
+
+// defineMetrics returns the metrics of conf, not registered with any registry.
+func defineMetrics(conf Metrics) *metrics {
+	underReplicatedHelp := "1 if Topic/Partition is under Replicated, 0 otherwise"
+	if conf.Compat == compatDanielqsj {
+		underReplicatedHelp = "1 if Topic/Partition has fewer In-Sync Replicas than Replicas, 0 otherwise"
+	}
+
 	m := &metrics{
+		cluster: clusterMetrics{
+			info: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_cluster_info",
+				Help: "Information about the Kafka cluster (cluster_id, controller, metadata_version* (if KRaft) )",
+			}, []string{"cluster_id", "controller", "metadata_version"}),
+			finalizedFeatureLevel: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_cluster_feature_finalized_level",
+				Help: "Finalized version level of a cluster wide feature",
+			}, []string{"feature"}),
+		},
 		broker: brokerMetrics{
 			brokers: prometheus.NewGauge(prometheus.GaugeOpts{
 				Name: "kafka_brokers",
@@ -19,12 +71,24 @@ func newMetrics(reg *prometheus.Registry) *metrics {
 			}),
 			brokerInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 				Name: "kafka_broker_info",
-				Help: "Information about the broker (node_id, host, rack_id* (if present) )",
-			}, []string{"id", "address", "rack"}),
+				Help: "Information about the broker (node_id, host, rack_id* (if present), detected Kafka version )",
+			}, []string{"id", "address", "rack", "version"}),
 			controller: prometheus.NewGauge(prometheus.GaugeOpts{
 				Name: "kafka_broker_controller",
 				Help: "ID of the broker that is currently the controller for the Kafka cluster",
 			}),
+			apiMinVersion: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_api_min_version",
+				Help: "Minimum version of an API supported by the broker",
+			}, []string{"id", "api"}),
+			apiMaxVersion: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_api_max_version",
+				Help: "Maximum version of an API supported by the broker",
+			}, []string{"id", "api"}),
+			supportedFeatureMaxLevel: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_feature_supported_max_level",
+				Help: "Maximum version level of a feature supported by the broker",
+			}, []string{"id", "feature"}),
 		},
 		topic: topicMetrics{
 			partitions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
@@ -45,7 +109,7 @@ func newMetrics(reg *prometheus.Registry) *metrics {
 			}, []string{"topic", "partition"}),
 			partitionUnderRep: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 				Name: "kafka_topic_partition_under_replicated_partition",
-				Help: "1 if Topic/Partition is under Replicated, 0 otherwise",
+				Help: underReplicatedHelp,
 			}, []string{"topic", "partition"}),
 			partitionLeaderIsPreferred: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 				Name: "kafka_topic_partition_leader_is_preferred",
@@ -59,6 +123,14 @@ func newMetrics(reg *prometheus.Registry) *metrics {
 				Name: "kafka_topic_partition_oldest_offset",
 				Help: "Oldest Offset of a Topic/Partition",
 			}, []string{"topic", "partition"}),
+			partitionLastStableOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_last_stable_offset",
+				Help: "Last Stable Offset of a Topic/Partition, the offset up to which read_committed consumers can read",
+			}, []string{"topic", "partition"}),
+			partitionProduceRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_produce_rate",
+				Help: "Messages produced per second to a Topic/Partition, averaged over the rate window",
+			}, []string{"topic", "partition"}),
 			isInternal: prometheus.NewGaugeVec(prometheus.GaugeOpts{
 				Name: "kafka_topic_is_internal",
 				Help: "1 if the Topic is an internal Topic, 0 otherwise",
@@ -81,39 +153,438 @@ func newMetrics(reg *prometheus.Registry) *metrics {
 				Name: "kafka_consumergroup_current_offset",
 				Help: "Current Offset of a ConsumerGroup at Topic/Partition",
 			}, []string{"consumergroup", "topic", "partition"}),
+			consumeRate: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_consume_rate",
+				Help: "Messages consumed per second by a ConsumerGroup at Topic/Partition, averaged over the rate window",
+			}, []string{"consumergroup", "topic", "partition"}),
+			status: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_status",
+				Help: "Worst status of a ConsumerGroup across its partitions (0: OK, 1: WARNING, 2: ERROR, 3: STOP, 4: STALL)",
+			}, []string{"consumergroup"}),
+			partitionStatus: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_partition_status",
+				Help: "Status of a ConsumerGroup at Topic/Partition (0: OK, 1: WARNING, 2: ERROR, 3: STOP, 4: STALL)",
+			}, []string{"consumergroup", "topic", "partition"}),
+			catchUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_catch_up_seconds",
+				Help: "Estimated seconds for a ConsumerGroup to consume its lag at the current consume rate, +Inf if it isn't consuming",
+			}, []string{"consumergroup"}),
+		},
+		quorum: quorumMetrics{
+			leader: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_leader",
+				Help: "ID of the controller that is currently the leader of the KRaft metadata quorum",
+			}, nil),
+			leaderEpoch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_leader_epoch",
+				Help: "Leader epoch of the KRaft metadata quorum",
+			}, nil),
+			highWatermark: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_high_watermark",
+				Help: "High watermark of the KRaft metadata log",
+			}, nil),
+			logEndOffset: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_replica_log_end_offset",
+				Help: "Log end offset of a voter or observer of the KRaft metadata log",
+			}, []string{"replica", "role"}),
+			lag: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_replica_lag",
+				Help: "Number of records a voter or observer is behind the leader of the KRaft metadata log",
+			}, []string{"replica", "role"}),
+			lastFetch: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_replica_last_fetch_timestamp_seconds",
+				Help: "Time at which a voter or observer last fetched from the leader of the KRaft metadata log",
+			}, []string{"replica", "role"}),
+			lastCaughtUp: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_quorum_replica_last_caught_up_timestamp_seconds",
+				Help: "Time at which a voter or observer was last caught up with the leader of the KRaft metadata log",
+			}, []string{"replica", "role"}),
 		},
-		reg: reg,
+		changes: changeMetrics{
+			controllerChanges: prometheus.NewCounter(prometheus.CounterOpts{
+				Name: "kafka_broker_controller_changes_total",
+				Help: "Number of times the controller of the Kafka cluster, the leader of the metadata quorum on KRaft clusters, changed",
+			}),
+			leaderChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_topic_partition_leader_changes_total",
+				Help: "Number of times the leader of this Topic/Partition changed",
+			}, []string{"topic", "partition"}),
+			isrShrinks: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_topic_partition_isr_shrinks_total",
+				Help: "Number of times replicas left the In-Sync Replicas of this Topic/Partition",
+			}, []string{"topic", "partition"}),
+			isrExpands: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_topic_partition_isr_expands_total",
+				Help: "Number of times replicas joined the In-Sync Replicas of this Topic/Partition",
+			}, []string{"topic", "partition"}),
+			brokerLeaderElections: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_broker_leader_elections_total",
+				Help: "Number of times the broker became the leader of a Topic/Partition",
+			}, []string{"id"}),
+			brokerISRShrinks: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_broker_isr_shrinks_total",
+				Help: "Number of times the broker left the In-Sync Replicas of a Topic/Partition",
+			}, []string{"id"}),
+			brokerISRExpands: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_broker_isr_expands_total",
+				Help: "Number of times the broker joined the In-Sync Replicas of a Topic/Partition",
+			}, []string{"id"}),
+		},
+		transaction: transactionMetrics{
+			activeProducers: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_active_producers",
+				Help: "Number of idempotent or transactional producers with state on this Topic/Partition",
+			}, []string{"topic", "partition"}),
+			partitionOldestOpenAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_oldest_open_transaction_age_seconds",
+				Help: "Age of the oldest transaction open on this Topic/Partition",
+			}, []string{"topic", "partition"}),
+			partitionHanging: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_hanging_transactions",
+				Help: "Number of transactions open on this Topic/Partition for longer than the hanging threshold",
+			}, []string{"topic", "partition"}),
+			openAge: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_transaction_open_age_seconds",
+				Help: "Age of the open transaction of a transactional ID",
+			}, []string{"transactional_id"}),
+			hanging: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_transaction_hanging",
+				Help: "1 if the transaction of a transactional ID is open for longer than the hanging threshold, 0 otherwise",
+			}, []string{"transactional_id"}),
+			states: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_transactions",
+				Help: "Number of transactional IDs in each transaction state",
+			}, []string{"state"}),
+		},
+		quota: quotaMetrics{
+			clientQuota: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_client_quota",
+				Help: "Value of a client quota configured for a user, client-id and/or ip entity",
+			}, []string{"user", "client_id", "ip", "key"}),
+			scramIterations: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_scram_credential_iterations",
+				Help: "Number of iterations of a SCRAM credential configured for a user",
+			}, []string{"user", "mechanism"}),
+		},
+		acl: aclMetrics{
+			acls: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_acls",
+				Help: "Number of ACLs for a resource type, principal, operation and permission type",
+			}, []string{"resource_type", "principal", "operation", "permission"}),
+		},
+		permission: permissionMetrics{
+			authorized: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_exporter_collector_authorized",
+				Help: "1 if the exporter is authorized to run the collector, 0 if the collector was disabled by the permission self-check",
+			}, []string{"collector"}),
+		},
+		drift: driftMetrics{
+			differsFromMajority: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_config_differs_from_majority",
+				Help: "1 if the value of a dynamic broker config differs from the value most brokers have, 0 otherwise",
+			}, []string{"id", "key"}),
+			drift: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_config_drift",
+				Help: "1 for every broker or topic config whose value differs from the desired state",
+			}, []string{"resource", "name", "key"}),
+		},
+		canary: canaryMetrics{
+			produceLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_canary_produce_latency_seconds",
+				Help:    "Time for a canary record to be acknowledged by all in-sync replicas, by leader broker",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"id"}),
+			endToEndLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_canary_end_to_end_latency_seconds",
+				Help:    "Time from producing a canary record to consuming it, by leader broker",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"id"}),
+			produceErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_canary_produce_errors_total",
+				Help: "Number of canary records that failed to be produced, by leader broker",
+			}, []string{"id"}),
+			available: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_canary_broker_available",
+				Help: "1 if the canary records of every partition led by the broker were produced and consumed in time, 0 otherwise",
+			}, []string{"id"}),
+		},
+		client: clientMetrics{
+			connectLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_exporter_broker_connect_latency_seconds",
+				Help:    "Time for the exporter to dial a broker",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"id"}),
+			connectErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_broker_connect_errors_total",
+				Help: "Number of times the exporter failed to dial a broker",
+			}, []string{"id"}),
+			saslFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_broker_sasl_authentication_failures_total",
+				Help: "Number of times the SASL authentication of the exporter to a broker failed",
+			}, []string{"id"}),
+			writtenBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_broker_written_bytes_total",
+				Help: "Number of bytes of requests the exporter wrote to a broker",
+			}, []string{"id"}),
+			readBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_broker_read_bytes_total",
+				Help: "Number of bytes of responses the exporter read from a broker",
+			}, []string{"id"}),
+			throttle: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_exporter_broker_throttle_seconds",
+				Help:    "Time a broker throttled the exporter for",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"id"}),
+			requestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_exporter_broker_request_latency_seconds",
+				Help:    "Time from writing a request of the exporter to a broker to reading its response, by API",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"id", "api"}),
+			requestErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_broker_request_errors_total",
+				Help: "Number of requests of the exporter that failed to be written to or read from a broker, by API",
+			}, []string{"id", "api"}),
+			resolutionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_bootstrap_resolution_failures_total",
+				Help: "Number of times the exporter failed to look the brokers of a dns+srv bootstrap address up",
+			}, []string{"address"}),
+			certNotAfter: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_tls_cert_not_after_seconds",
+				Help: "Time after which a certificate of the chain a broker presented expires",
+			}, []string{"broker", "subject", "issuer"}),
+			certVerificationFailed: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_tls_cert_verification_failed",
+				Help: "1 if the certificate chain a broker presented didn't verify when the exporter last connected, 0 otherwise",
+			}, []string{"broker"}),
+		},
+		remoteWrite: remoteWriteMetrics{
+			sent: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_remote_write_requests_total",
+				Help: "Number of remote write requests the endpoint accepted",
+			}, []string{"url"}),
+			failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_remote_write_failures_total",
+				Help: "Number of remote write requests given up on after failing to be sent",
+			}, []string{"url"}),
+			retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_remote_write_retries_total",
+				Help: "Number of times a remote write request was sent again after a recoverable failure",
+			}, []string{"url"}),
+			dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_remote_write_dropped_total",
+				Help: "Number of export cycles whose metrics weren't sent because the queue of the endpoint was full",
+			}, []string{"url"}),
+			queueLength: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_exporter_remote_write_queue_length",
+				Help: "Number of remote write requests waiting to be sent to the endpoint",
+			}, []string{"url"}),
+			duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+				Name:    "kafka_exporter_remote_write_duration_seconds",
+				Help:    "Time to send a remote write request to the endpoint",
+				Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+			}, []string{"url"}),
+		},
+		otlp: otlpMetrics{
+			exports: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_otlp_exports_total",
+				Help: "Number of times the metrics were pushed to the OpenTelemetry collector",
+			}, []string{"endpoint"}),
+			failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_otlp_export_failures_total",
+				Help: "Number of times the metrics failed to be pushed to the OpenTelemetry collector",
+			}, []string{"endpoint"}),
+		},
+		sink: sinkMetrics{
+			failures: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_sink_write_failures_total",
+				Help: "Number of times the metrics failed to be written to a sink",
+			}, []string{"sink"}),
+			dropped: prometheus.NewCounterVec(prometheus.CounterOpts{
+				Name: "kafka_exporter_sink_dropped_total",
+				Help: "Number of refreshes whose metrics weren't written to a sink because it was still writing earlier ones",
+			}, []string{"sink"}),
+		},
+		conf: conf,
+	}
+
+	if conf.Compat == compatDanielqsj {
+		m.danielqsj = &danielqsjMetrics{
+			brokerInfo: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_broker_info",
+				Help: "Information about the Kafka Broker",
+			}, []string{"address", "id"}),
+			partitionISR: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_topic_partition_in_sync_replica",
+				Help: "Number of In-Sync Replicas for this Topic/Partition",
+			}, []string{"topic", "partition"}),
+			lagSum: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_lag_sum",
+				Help: "Current Approximate Lag of a ConsumerGroup at Topic for all partitions",
+			}, []string{"consumergroup", "topic"}),
+			currentOffsetSum: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+				Name: "kafka_consumergroup_current_offset_sum",
+				Help: "Current Offset of a ConsumerGroup at Topic for all partitions",
+			}, []string{"consumergroup", "topic"}),
+		}
 	}
 
-	m.register(reg)
 	return m
 }
 
-func (m *metrics) register(reg *prometheus.Registry) {
-	reg.MustRegister(
-		m.broker.brokers,
-		m.broker.brokerInfo,
-		m.broker.controller,
-		m.topic.partitions,
-		m.topic.partitionLeader,
-		m.topic.partitionReplicas,
-		m.topic.partitionISR,
-		m.topic.partitionUnderRep,
-		m.topic.partitionLeaderIsPreferred,
-		m.topic.partitionCurrentOffset,
-		m.topic.partitionOldestOffset,
-		m.topic.isInternal,
-		m.group.members,
-		m.group.coordinator,
-		m.group.lag,
-		m.group.currentOffset,
-	)
+// register registers the metrics with reg and groups them into the
+// collections that can be selected with collect[] on /metrics.
+func (m *metrics) register(reg *prometheus.Registry) error {
+	m.collections = map[string][]prometheus.Collector{
+		"cluster": {
+			m.cluster.info,
+			m.cluster.finalizedFeatureLevel,
+		},
+		"brokers": {
+			m.broker.brokers,
+			m.broker.brokerInfo,
+			m.broker.controller,
+			m.broker.apiMinVersion,
+			m.broker.apiMaxVersion,
+			m.broker.supportedFeatureMaxLevel,
+		},
+		"topics": {
+			m.topic.partitions,
+			m.topic.partitionLeader,
+			m.topic.partitionReplicas,
+			m.topic.partitionISR,
+			m.topic.partitionUnderRep,
+			m.topic.partitionLeaderIsPreferred,
+			m.topic.partitionCurrentOffset,
+			m.topic.partitionOldestOffset,
+			m.topic.partitionLastStableOffset,
+			m.topic.partitionProduceRate,
+			m.topic.isInternal,
+		},
+		"groups": {
+			m.group.members,
+			m.group.coordinator,
+			m.group.lag,
+			m.group.currentOffset,
+			m.group.consumeRate,
+			m.group.catchUp,
+			m.group.status,
+			m.group.partitionStatus,
+		},
+		"quorum": {
+			m.quorum.leader,
+			m.quorum.leaderEpoch,
+			m.quorum.highWatermark,
+			m.quorum.logEndOffset,
+			m.quorum.lag,
+			m.quorum.lastFetch,
+			m.quorum.lastCaughtUp,
+		},
+		"changes": {
+			m.changes.controllerChanges,
+			m.changes.leaderChanges,
+			m.changes.isrShrinks,
+			m.changes.isrExpands,
+			m.changes.brokerLeaderElections,
+			m.changes.brokerISRShrinks,
+			m.changes.brokerISRExpands,
+		},
+		"transactions": {
+			m.transaction.activeProducers,
+			m.transaction.partitionOldestOpenAge,
+			m.transaction.partitionHanging,
+			m.transaction.openAge,
+			m.transaction.hanging,
+			m.transaction.states,
+		},
+		"quotas": {
+			m.quota.clientQuota,
+			m.quota.scramIterations,
+		},
+		"acls": {
+			m.acl.acls,
+		},
+		"permissions": {
+			m.permission.authorized,
+		},
+		"drift": {
+			m.drift.differsFromMajority,
+			m.drift.drift,
+		},
+		"canary": {
+			m.canary.produceLatency,
+			m.canary.endToEndLatency,
+			m.canary.produceErrors,
+			m.canary.available,
+		},
+		"client": {
+			m.client.connectLatency,
+			m.client.connectErrors,
+			m.client.saslFailures,
+			m.client.writtenBytes,
+			m.client.readBytes,
+			m.client.throttle,
+			m.client.requestLatency,
+			m.client.requestErrors,
+			m.client.resolutionFailures,
+			m.client.certNotAfter,
+			m.client.certVerificationFailed,
+		},
+		"remote_write": {
+			m.remoteWrite.sent,
+			m.remoteWrite.failures,
+			m.remoteWrite.retries,
+			m.remoteWrite.dropped,
+			m.remoteWrite.queueLength,
+			m.remoteWrite.duration,
+		},
+		"otlp": {
+			m.otlp.exports,
+			m.otlp.failures,
+		},
+		"sinks": {
+			m.sink.failures,
+			m.sink.dropped,
+		},
+	}
+
+	if d := m.danielqsj; d != nil {
+		// kafka_broker_info has other labels in danielqsj/kafka_exporter
+		brokers := m.collections["brokers"]
+		brokers[slices.Index(brokers, prometheus.Collector(m.broker.brokerInfo))] = d.brokerInfo
+
+		m.collections["topics"] = append(m.collections["topics"], d.partitionISR)
+		m.collections["groups"] = append(m.collections["groups"], d.lagSum, d.currentOffsetSum)
+	}
+
+	wrapped := m.registerer(reg)
+	for _, collectors := range m.collections {
+		for _, c := range collectors {
+			if err := wrapped.Register(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// registerer returns reg wrapped to add the namespace and the constant labels
+// to the metrics registered with it.
+func (m *metrics) registerer(reg prometheus.Registerer) prometheus.Registerer {
+	return prometheus.WrapRegistererWith(m.conf.Labels, prometheus.WrapRegistererWithPrefix(m.conf.prefix(), reg))
+}
+
+type clusterMetrics struct {
+	info                  *prometheus.GaugeVec
+	finalizedFeatureLevel *prometheus.GaugeVec
 }
 
 type brokerMetrics struct {
-	brokers    prometheus.Gauge
-	brokerInfo *prometheus.GaugeVec
-	controller prometheus.Gauge
+	brokers                  prometheus.Gauge
+	brokerInfo               *prometheus.GaugeVec
+	controller               prometheus.Gauge
+	apiMinVersion            *prometheus.GaugeVec
+	apiMaxVersion            *prometheus.GaugeVec
+	supportedFeatureMaxLevel *prometheus.GaugeVec
 }
 
 type topicMetrics struct {
@@ -125,12 +596,116 @@ type topicMetrics struct {
 	partitionLeaderIsPreferred *prometheus.GaugeVec
 	partitionCurrentOffset     *prometheus.GaugeVec
 	partitionOldestOffset      *prometheus.GaugeVec
+	partitionLastStableOffset  *prometheus.GaugeVec
+	partitionProduceRate       *prometheus.GaugeVec
 	isInternal                 *prometheus.GaugeVec
 }
 
 type consumerGroupMetrics struct {
-	members       *prometheus.GaugeVec
-	coordinator   *prometheus.GaugeVec
+	members         *prometheus.GaugeVec
+	coordinator     *prometheus.GaugeVec
+	lag             *prometheus.GaugeVec
+	currentOffset   *prometheus.GaugeVec
+	consumeRate     *prometheus.GaugeVec
+	catchUp         *prometheus.GaugeVec
+	status          *prometheus.GaugeVec
+	partitionStatus *prometheus.GaugeVec
+}
+
+type quorumMetrics struct {
+	leader        *prometheus.GaugeVec
+	leaderEpoch   *prometheus.GaugeVec
+	highWatermark *prometheus.GaugeVec
+	logEndOffset  *prometheus.GaugeVec
 	lag           *prometheus.GaugeVec
-	currentOffset *prometheus.GaugeVec
+	lastFetch     *prometheus.GaugeVec
+	lastCaughtUp  *prometheus.GaugeVec
+}
+
+type changeMetrics struct {
+	controllerChanges     prometheus.Counter
+	leaderChanges         *prometheus.CounterVec
+	isrShrinks            *prometheus.CounterVec
+	isrExpands            *prometheus.CounterVec
+	brokerLeaderElections *prometheus.CounterVec
+	brokerISRShrinks      *prometheus.CounterVec
+	brokerISRExpands      *prometheus.CounterVec
+}
+
+type transactionMetrics struct {
+	activeProducers        *prometheus.GaugeVec
+	partitionOldestOpenAge *prometheus.GaugeVec
+	partitionHanging       *prometheus.GaugeVec
+	openAge                *prometheus.GaugeVec
+	hanging                *prometheus.GaugeVec
+	states                 *prometheus.GaugeVec
+}
+
+type quotaMetrics struct {
+	clientQuota     *prometheus.GaugeVec
+	scramIterations *prometheus.GaugeVec
+}
+
+type aclMetrics struct {
+	acls *prometheus.GaugeVec
+}
+
+type permissionMetrics struct {
+	authorized *prometheus.GaugeVec
+}
+
+type driftMetrics struct {
+	differsFromMajority *prometheus.GaugeVec
+	drift               *prometheus.GaugeVec
+}
+
+type canaryMetrics struct {
+	produceLatency  *prometheus.HistogramVec
+	endToEndLatency *prometheus.HistogramVec
+	produceErrors   *prometheus.CounterVec
+	available       *prometheus.GaugeVec
+}
+
+type clientMetrics struct {
+	connectLatency *prometheus.HistogramVec
+	connectErrors  *prometheus.CounterVec
+	saslFailures   *prometheus.CounterVec
+	writtenBytes   *prometheus.CounterVec
+	readBytes      *prometheus.CounterVec
+	throttle       *prometheus.HistogramVec
+	requestLatency *prometheus.HistogramVec
+	requestErrors  *prometheus.CounterVec
+
+	resolutionFailures *prometheus.CounterVec
+
+	certNotAfter           *prometheus.GaugeVec
+	certVerificationFailed *prometheus.GaugeVec
+}
+
+type remoteWriteMetrics struct {
+	sent        *prometheus.CounterVec
+	failures    *prometheus.CounterVec
+	retries     *prometheus.CounterVec
+	dropped     *prometheus.CounterVec
+	queueLength *prometheus.GaugeVec
+	duration    *prometheus.HistogramVec
+}
+
+type otlpMetrics struct {
+	exports  *prometheus.CounterVec
+	failures *prometheus.CounterVec
+}
+
+type sinkMetrics struct {
+	failures *prometheus.CounterVec
+	dropped  *prometheus.CounterVec
+}
+
+// danielqsjMetrics are the danielqsj/kafka_exporter metrics whose names,
+// labels or values differ from ours.
+type danielqsjMetrics struct {
+	brokerInfo       *prometheus.GaugeVec
+	partitionISR     *prometheus.GaugeVec
+	lagSum           *prometheus.GaugeVec
+	currentOffsetSum *prometheus.GaugeVec
 }
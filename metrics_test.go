@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/plugin/kphuslog"
+)
+
+func TestMetricsNamespaceAndCompat(t *testing.T) {
+	c, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(2, "orders"))
+	conf.Metrics = Metrics{
+		Namespace: "acme",
+		Labels:    map[string]string{"env": "prod"},
+		Compat:    compatDanielqsj,
+	}
+
+	client, err := kgo.NewClient(append(
+		testOpts(t, conf),
+		kgo.ConsumerGroup("billing"),
+		kgo.ConsumeTopics("orders"),
+		kgo.RecordPartitioner(kgo.ManualPartitioner()),
+		kgo.WithLogger(kphuslog.New(&log.Logger{Level: log.ErrorLevel})),
+	)...)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	ctx := context.Background()
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	for partition, values := range [][]string{{"a", "b", "c"}, {"d", "e"}} {
+		for _, value := range values {
+			record := &kgo.Record{Topic: "orders", Partition: int32(partition), Value: []byte(value)}
+			if err := client.ProduceSync(ctx, record).FirstErr(); err != nil {
+				t.Fatal(err, "failed to produce")
+			}
+		}
+	}
+	if err := client.PollFetches(ctx).Err(); err != nil {
+		t.Fatal(err, "failed to poll")
+	}
+
+	// commit the first record of both partitions, leaving a lag of 2 and 1
+	var commitErr error
+	client.CommitOffsetsSync(ctx, map[string]map[int32]kgo.EpochOffset{
+		"orders": {0: {Epoch: -1, Offset: 1}, 1: {Epoch: -1, Offset: 1}},
+	}, func(_ *kgo.Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+		commitErr = err
+	})
+	if err := commitErr; err != nil {
+		t.Fatal(err, "failed to commit")
+	}
+
+	if err := e.export(ctx); err != nil {
+		t.Fatal(err, "failed to export")
+	}
+
+	scrape := func(query string) string {
+		w := httptest.NewRecorder()
+		e.metricsHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics?"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatal("expected 200, got", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	body := scrape("")
+	for _, s := range []string{
+		`acme_kafka_brokers{env="prod"} 1`,
+		`acme_kafka_consumergroup_lag{consumergroup="billing",env="prod",partition="0",topic="orders"} 2`,
+		`acme_kafka_consumergroup_lag_sum{consumergroup="billing",env="prod",topic="orders"} 3`,
+		`acme_kafka_consumergroup_current_offset_sum{consumergroup="billing",env="prod",topic="orders"} 2`,
+		`acme_kafka_topic_partition_in_sync_replica{env="prod",partition="0",topic="orders"} 1`,
+		`acme_kafka_topic_partition_under_replicated_partition{env="prod",partition="0",topic="orders"} 0`,
+		`acme_kafka_broker_info{address="` + c.ListenAddrs()[0] + `",env="prod",id="0"} 1`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in the metrics", s)
+		}
+	}
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "kafka_") {
+			t.Error("expected every metric to be namespaced, got", line)
+		}
+	}
+
+	if body := scrape("collect[]=groups"); !strings.Contains(body, `acme_kafka_consumergroup_lag_sum{consumergroup="billing",env="prod",topic="orders"} 3`) {
+		t.Error("expected the filtered metrics to be namespaced and labeled")
+	}
+
+	families, err := e.metrics.reg.Gather()
+	if err != nil {
+		t.Fatal(err, "failed to gather")
+	}
+	if samples := publishedSamples(sink.Flatten(families), conf.Metrics.prefix(), time.Now()); len(samples) != 4 {
+		t.Error("expected the lag and offset of both partitions to be published, got", samples)
+	}
+}
+
+func TestCompatUnmarshalText(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		err  bool
+	}{
+		{text: ""},
+		{text: "danielqsj"},
+		{text: "burrow", err: true},
+	} {
+		var compat Compat
+		if err := compat.UnmarshalText([]byte(tc.text)); (err != nil) != tc.err {
+			t.Errorf("unexpected error for %q: %v", tc.text, err)
+		}
+	}
+}
+
+func TestMetricsValidate(t *testing.T) {
+	for _, tc := range []struct {
+		conf Metrics
+		err  bool
+	}{
+		{conf: Metrics{}},
+		{conf: Metrics{Namespace: "acme", Labels: map[string]string{"env": "prod"}, Compat: compatDanielqsj}},
+		{conf: Metrics{Namespace: "acme-corp"}, err: true},
+		{conf: Metrics{Namespace: "1acme"}, err: true},
+		{conf: Metrics{Labels: map[string]string{"cluster-name": "prod"}}, err: true},
+		{conf: Metrics{Labels: map[string]string{"__cluster": "prod"}}, err: true},
+		// labels of the exported metrics
+		{conf: Metrics{Labels: map[string]string{"topic": "orders"}}, err: true},
+		{conf: Metrics{Labels: map[string]string{"consumergroup": "billing"}, Compat: compatDanielqsj}, err: true},
+	} {
+		if err := tc.conf.validate(); (err != nil) != tc.err {
+			t.Errorf("unexpected error for %+v: %v", tc.conf, err)
+		}
+	}
+}
+
+func TestUnderReplicated(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		partition kadm.PartitionDetail
+		compat    Compat
+		expected  int
+	}{
+		{
+			name:      "in sync",
+			partition: kadm.PartitionDetail{Replicas: []int32{0, 1, 2}, ISR: []int32{0, 1, 2}},
+		},
+		{
+			name:      "replica out of sync",
+			partition: kadm.PartitionDetail{Replicas: []int32{0, 1, 2}, ISR: []int32{0, 1}},
+		},
+		{
+			name:      "replica offline",
+			partition: kadm.PartitionDetail{Replicas: []int32{0, 1, 2}, ISR: []int32{0, 1}, OfflineReplicas: []int32{2}},
+			expected:  1,
+		},
+		{
+			name:      "replica out of sync with danielqsj",
+			partition: kadm.PartitionDetail{Replicas: []int32{0, 1, 2}, ISR: []int32{0, 1}},
+			compat:    compatDanielqsj,
+			expected:  1,
+		},
+		{
+			name:      "in sync with danielqsj",
+			partition: kadm.PartitionDetail{Replicas: []int32{0, 1, 2}, ISR: []int32{0, 1, 2}},
+			compat:    compatDanielqsj,
+		},
+	} {
+		if got := underReplicated(tc.partition, tc.compat); got != tc.expected {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.expected, got)
+		}
+	}
+
+	// the help tells which meaning the metric has
+	for compat, help := range map[Compat]string{
+		"":              "1 if Topic/Partition is under Replicated, 0 otherwise",
+		compatDanielqsj: "1 if Topic/Partition has fewer In-Sync Replicas than Replicas, 0 otherwise",
+	} {
+		m := newMetrics(prometheus.NewRegistry(), Metrics{Compat: compat})
+		m.topic.partitionUnderRep.With(prometheus.Labels{"topic": "orders", "partition": "0"}).Set(0)
+
+		families, err := m.reg.Gather()
+		if err != nil {
+			t.Fatal(err, "failed to gather")
+		}
+		for _, family := range families {
+			if family.GetName() == "kafka_topic_partition_under_replicated_partition" && family.GetHelp() != help {
+				t.Errorf("expected help %q with compat %q, got %q", help, compat, family.GetHelp())
+			}
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// otlpPusher pushes the metrics to an OpenTelemetry collector every interval,
+// so that the exporter can run without being scraped.
+type otlpPusher struct {
+	config OTLP
+	// prefix is prepended to the name of every metric
+	prefix   string
+	metrics  otlpMetrics
+	exporter sdkmetric.Exporter
+
+	// gather returns the metric families to push
+	gather func() ([]*dto.MetricFamily, error)
+	// start is the start time of the cumulative counters and histograms
+	start time.Time
+}
+
+func newOTLPPusher(conf OTLP, prefix string, metrics otlpMetrics, gather func() ([]*dto.MetricFamily, error)) (*otlpPusher, error) {
+	if conf.Instance == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get hostname for the otlp instance: %w", err)
+		}
+		conf.Instance = hostname
+	}
+
+	var (
+		exporter sdkmetric.Exporter
+		err      error
+	)
+	switch conf.Protocol {
+	case "grpc":
+		exporter, err = otlpmetricgrpc.New(context.Background(),
+			otlpmetricgrpc.WithEndpointURL(conf.Endpoint),
+			otlpmetricgrpc.WithHeaders(conf.Headers),
+			otlpmetricgrpc.WithTimeout(conf.Timeout),
+		)
+	case "http/protobuf":
+		exporter, err = otlpmetrichttp.New(context.Background(),
+			otlpmetrichttp.WithEndpointURL(conf.Endpoint),
+			otlpmetrichttp.WithHeaders(conf.Headers),
+			otlpmetrichttp.WithTimeout(conf.Timeout),
+		)
+	default:
+		return nil, fmt.Errorf("unknown otlp protocol: %s", conf.Protocol)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &otlpPusher{
+		config:   conf,
+		prefix:   prefix,
+		metrics:  metrics,
+		exporter: exporter,
+		gather:   gather,
+		start:    time.Now(),
+	}, nil
+}
+
+// run pushes the metrics every interval until ctx is done.
+func (p *otlpPusher) run(ctx context.Context) {
+	defer func() {
+		if err := p.exporter.Shutdown(context.Background()); err != nil {
+			log.Error().Err(err).Msg("failed to shut the otlp exporter down")
+		}
+	}()
+
+	t := time.NewTicker(p.config.Interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		if err := p.push(ctx); err != nil {
+			log.Error().Err(err).Msg("failed to push metrics over otlp")
+			p.metrics.failures.With(prometheus.Labels{"endpoint": p.config.Endpoint}).Inc()
+			continue
+		}
+		p.metrics.exports.With(prometheus.Labels{"endpoint": p.config.Endpoint}).Inc()
+	}
+}
+
+// push sends the current metrics to the collector.
+func (p *otlpPusher) push(ctx context.Context) error {
+	families, err := p.gather()
+	if err != nil {
+		return err
+	}
+
+	return p.exporter.Export(ctx, p.resourceMetrics(families, time.Now()))
+}
+
+// resourceMetrics converts the metric families to OpenTelemetry metrics: gauges
+// and untyped metrics to gauges, counters to cumulative monotonic sums, and
+// histograms to cumulative histograms.
+func (p *otlpPusher) resourceMetrics(families []*dto.MetricFamily, at time.Time) *metricdata.ResourceMetrics {
+	metrics := make([]metricdata.Metrics, 0, len(families))
+	for _, family := range families {
+		var data metricdata.Aggregation
+		switch family.GetType() {
+		case dto.MetricType_GAUGE, dto.MetricType_UNTYPED:
+			gauge := metricdata.Gauge[float64]{}
+			for _, metric := range family.GetMetric() {
+				value := metric.GetGauge().GetValue()
+				if family.GetType() == dto.MetricType_UNTYPED {
+					value = metric.GetUntyped().GetValue()
+				}
+
+				gauge.DataPoints = append(gauge.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: attributes(metric),
+					Time:       at,
+					Value:      value,
+				})
+			}
+			data = gauge
+		case dto.MetricType_COUNTER:
+			sum := metricdata.Sum[float64]{Temporality: metricdata.CumulativeTemporality, IsMonotonic: true}
+			for _, metric := range family.GetMetric() {
+				sum.DataPoints = append(sum.DataPoints, metricdata.DataPoint[float64]{
+					Attributes: attributes(metric),
+					StartTime:  p.start,
+					Time:       at,
+					Value:      metric.GetCounter().GetValue(),
+				})
+			}
+			data = sum
+		case dto.MetricType_HISTOGRAM:
+			histogram := metricdata.Histogram[float64]{Temporality: metricdata.CumulativeTemporality}
+			for _, metric := range family.GetMetric() {
+				h := metric.GetHistogram()
+
+				// prometheus buckets are cumulative, otlp ones aren't and
+				// have an implicit +Inf bucket
+				point := metricdata.HistogramDataPoint[float64]{
+					Attributes: attributes(metric),
+					StartTime:  p.start,
+					Time:       at,
+					Count:      h.GetSampleCount(),
+					Sum:        h.GetSampleSum(),
+				}
+				var previous uint64
+				for _, bucket := range h.GetBucket() {
+					point.Bounds = append(point.Bounds, bucket.GetUpperBound())
+					point.BucketCounts = append(point.BucketCounts, bucket.GetCumulativeCount()-previous)
+					previous = bucket.GetCumulativeCount()
+				}
+				point.BucketCounts = append(point.BucketCounts, h.GetSampleCount()-previous)
+
+				histogram.DataPoints = append(histogram.DataPoints, point)
+			}
+			data = histogram
+		default:
+			continue
+		}
+
+		metrics = append(metrics, metricdata.Metrics{
+			Name:        family.GetName(),
+			Description: family.GetHelp(),
+			Data:        data,
+		})
+	}
+
+	return &metricdata.ResourceMetrics{
+		Resource: resource.NewSchemaless(
+			attribute.String("service.name", "kafka-exporter"),
+			attribute.String("service.instance.id", p.config.Instance),
+			attribute.String("kafka.cluster.id", clusterID(families, p.prefix)),
+		),
+		ScopeMetrics: []metricdata.ScopeMetrics{{
+			Scope:   instrumentation.Scope{Name: "github.com/0xgirish/kafka-exporter"},
+			Metrics: metrics,
+		}},
+	}
+}
+
+func attributes(metric *dto.Metric) attribute.Set {
+	kvs := make([]attribute.KeyValue, 0, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		kvs = append(kvs, attribute.String(label.GetName(), label.GetValue()))
+	}
+	return attribute.NewSet(kvs...)
+}
+
+// clusterID returns the cluster ID exported by kafka_cluster_info, empty
+// before the first export cycle succeeds.
+func clusterID(families []*dto.MetricFamily, prefix string) string {
+	for _, family := range families {
+		if family.GetName() != prefix+"kafka_cluster_info" {
+			continue
+		}
+
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "cluster_id" {
+					return label.GetValue()
+				}
+			}
+		}
+	}
+	return ""
+}
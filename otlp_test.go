@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	colmetricpb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestOTLP(t *testing.T) {
+	requests := make(chan *colmetricpb.ExportMetricsServiceRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Scope-OrgID") != "kafka" {
+			t.Error("unexpected header", r.Header.Get("X-Scope-OrgID"))
+		}
+
+		body, _ := io.ReadAll(r.Body)
+		request := &colmetricpb.ExportMetricsServiceRequest{}
+		if err := proto.Unmarshal(body, request); err != nil {
+			t.Error(err, "failed to decode request")
+		}
+		requests <- request
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	metrics := newMetrics(reg, Metrics{})
+	metrics.cluster.info.With(prometheus.Labels{"cluster_id": "test", "controller": "1", "metadata_version": ""}).Set(1)
+	metrics.topic.partitions.With(prometheus.Labels{"topic": "orders"}).Set(3)
+
+	p, err := newOTLPPusher(OTLP{
+		Endpoint: server.URL,
+		Protocol: "http/protobuf",
+		Headers:  map[string]string{"X-Scope-OrgID": "kafka"},
+		Timeout:  time.Second,
+		Instance: "exporter-0",
+	}, "", metrics.otlp, reg.Gather)
+	if err != nil {
+		t.Fatal(err, "failed to create otlp pusher")
+	}
+
+	if err := p.push(context.Background()); err != nil {
+		t.Fatal(err, "failed to push metrics")
+	}
+
+	request := <-requests
+	if len(request.ResourceMetrics) != 1 {
+		t.Fatal("expected 1 resource, got", len(request.ResourceMetrics))
+	}
+
+	attributes := make(map[string]string)
+	for _, kv := range request.ResourceMetrics[0].Resource.Attributes {
+		attributes[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attributes["kafka.cluster.id"] != "test" || attributes["service.instance.id"] != "exporter-0" {
+		t.Error("unexpected resource attributes", attributes)
+	}
+
+	var found bool
+	for _, metric := range request.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if metric.Name != "kafka_topic_partitions" {
+			continue
+		}
+
+		found = true
+		points := metric.GetGauge().GetDataPoints()
+		if len(points) != 1 || points[0].GetAsDouble() != 3 {
+			t.Error("unexpected kafka_topic_partitions data points", points)
+		}
+	}
+	if !found {
+		t.Error("expected kafka_topic_partitions to be pushed")
+	}
+}
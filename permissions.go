@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+// collector is a part of the export cycle that needs a describe permission
+// the exporter's principal may not have.
+type collector struct {
+	name string
+	// needs is the ACL operation and resource type the collector describes
+	needs string
+	probe func(ctx context.Context) error
+}
+
+// permission is the outcome of probing a collector.
+type permission struct {
+	collector collector
+	err       error
+}
+
+func (p permission) authorized() bool {
+	return !isAuthorizationError(p.err)
+}
+
+func (p permission) String() string {
+	switch {
+	case p.err == nil:
+		return "authorized"
+	case !p.authorized():
+		return "unauthorized"
+	case unsupported(p.err):
+		return "unsupported"
+	default:
+		return fmt.Sprintf("error: %v", p.err)
+	}
+}
+
+// collectors returns the collectors to probe, only the enabled ones unless all
+// is set.
+func (e *exporter) collectors(all bool) []collector {
+	collectors := []collector{
+		{
+			name:  "groups",
+			needs: "DESCRIBE GROUP, DESCRIBE TOPIC",
+			probe: func(ctx context.Context) error {
+				lags, err := e.client.Lag(ctx)
+				if err != nil {
+					return err
+				}
+				for _, lag := range lags {
+					if lag.DescribeErr != nil {
+						return lag.DescribeErr
+					}
+					if lag.FetchErr != nil {
+						return lag.FetchErr
+					}
+				}
+				return nil
+			},
+		},
+		{
+			name:  "quorum",
+			needs: "DESCRIBE CLUSTER",
+			probe: func(ctx context.Context) error {
+				resp, err := describeQuorumRequest().RequestWith(ctx, e.kafka)
+				if err != nil {
+					return err
+				}
+				return kerr.ErrorForCode(resp.ErrorCode)
+			},
+		},
+	}
+
+	if all || e.config.Transactions.Enabled {
+		collectors = append(collectors, collector{
+			name:  "transactions",
+			needs: "READ TOPIC, DESCRIBE TRANSACTIONAL_ID",
+			probe: func(ctx context.Context) error {
+				metadata, err := e.client.Metadata(ctx)
+				if err != nil {
+					return err
+				}
+				producers, err := e.client.DescribeProducers(ctx, metadata.Topics.TopicsSet())
+				if err != nil && !partialFailure(err) {
+					return err
+				}
+				var perr error
+				producers.EachPartition(func(p kadm.DescribedProducersPartition) {
+					if p.Err != nil && perr == nil {
+						perr = p.Err
+					}
+				})
+				if perr != nil {
+					return perr
+				}
+				_, err = e.client.DescribeTransactions(ctx)
+				if partialFailure(err) {
+					return nil
+				}
+				return err
+			},
+		})
+	}
+
+	if all || e.config.Quotas.Enabled {
+		collectors = append(collectors, collector{
+			name:  "quotas",
+			needs: "DESCRIBE_CONFIGS CLUSTER, DESCRIBE CLUSTER",
+			probe: func(ctx context.Context) error {
+				if _, err := e.client.DescribeClientQuotas(ctx, false, nil); err != nil {
+					return err
+				}
+				_, err := e.client.DescribeUserSCRAMs(ctx)
+				return err
+			},
+		})
+	}
+
+	if all || e.config.ACLs.Enabled {
+		collectors = append(collectors, collector{
+			name:  "acls",
+			needs: "DESCRIBE CLUSTER",
+			probe: func(ctx context.Context) error {
+				results, err := e.client.DescribeACLs(ctx, everyACL())
+				if err != nil {
+					return err
+				}
+				for _, result := range results {
+					if result.Err != nil {
+						return result.Err
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	if all || e.config.Drift.Enabled {
+		collectors = append(collectors, collector{
+			name:  "drift",
+			needs: "DESCRIBE_CONFIGS CLUSTER, DESCRIBE_CONFIGS TOPIC",
+			probe: func(ctx context.Context) error {
+				metadata, err := e.client.Metadata(ctx)
+				if err != nil {
+					return err
+				}
+				brokers, err := e.client.DescribeBrokerConfigs(ctx, metadata.Brokers.NodeIDs()...)
+				if err != nil && !partialFailure(err) {
+					return err
+				}
+				topics, err := e.client.DescribeTopicConfigs(ctx, metadata.Topics.Names()...)
+				if err != nil && !partialFailure(err) {
+					return err
+				}
+				for _, r := range append(brokers, topics...) {
+					if r.Err != nil {
+						return r.Err
+					}
+				}
+				return nil
+			},
+		})
+	}
+
+	return collectors
+}
+
+// checkPermissions probes every collector with the describe requests it
+// issues.
+func (e *exporter) checkPermissions(ctx context.Context, all bool) []permission {
+	var permissions []permission
+	for _, c := range e.collectors(all) {
+		permissions = append(permissions, permission{collector: c, err: c.probe(ctx)})
+	}
+	return permissions
+}
+
+// disableUnauthorized disables the collectors the exporter's principal isn't
+// authorized to run, so that they don't fail every export cycle until the
+// exporter exits.
+func (e *exporter) disableUnauthorized(ctx context.Context) {
+	for _, p := range e.checkPermissions(ctx, false) {
+		authorized := 0
+		if p.authorized() {
+			authorized = 1
+		}
+		e.metrics.permission.authorized.With(prometheus.Labels{"collector": p.collector.name}).Set(float64(authorized))
+
+		if p.authorized() {
+			log.Debug().Str("collector", p.collector.name).Str("permission", p.String()).Msg("checked collector permissions")
+			continue
+		}
+
+		log.Warn().
+			Err(p.err).
+			Str("collector", p.collector.name).
+			Str("needs", p.collector.needs).
+			Msg("not authorized to run collector, disabling it")
+		e.disabled[p.collector.name] = true
+	}
+}
+
+// collecting reports whether the named collector wasn't disabled by the
+// permission self-check.
+func (e *exporter) collecting(name string) bool {
+	return !e.disabled[name]
+}
+
+// printPermissions writes a report of the permissions and reports whether
+// every collector is authorized.
+func printPermissions(w io.Writer, permissions []permission) bool {
+	ok := true
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLLECTOR\tNEEDS\tPERMISSION")
+	for _, p := range permissions {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", p.collector.name, p.collector.needs, p)
+		ok = ok && p.authorized()
+	}
+	tw.Flush()
+	return ok
+}
+
+// isAuthorizationError reports whether err means the principal lacks an ACL.
+func isAuthorizationError(err error) bool {
+	var authErr *kadm.AuthError
+	return errors.As(err, &authErr) ||
+		errors.Is(err, kerr.ClusterAuthorizationFailed) ||
+		errors.Is(err, kerr.TopicAuthorizationFailed) ||
+		errors.Is(err, kerr.GroupAuthorizationFailed) ||
+		errors.Is(err, kerr.TransactionalIDAuthorizationFailed)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestIsAuthorizationError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: nil, want: false},
+		{err: kerr.UnsupportedVersion, want: false},
+		{err: kerr.ClusterAuthorizationFailed, want: true},
+		{err: fmt.Errorf("describe: %w", kerr.GroupAuthorizationFailed), want: true},
+		{err: &kadm.AuthError{Err: kerr.TopicAuthorizationFailed}, want: true},
+	}
+
+	for _, tt := range tests {
+		if got := isAuthorizationError(tt.err); got != tt.want {
+			t.Errorf("isAuthorizationError(%v) = %t, want %t", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	_, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "topic1"))
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	permissions := e.checkPermissions(context.Background(), true)
+	if len(permissions) != 6 {
+		t.Fatalf("expected every collector to be checked, got %d", len(permissions))
+	}
+
+	for _, p := range permissions {
+		if !p.authorized() {
+			t.Errorf("expected collector %s to be authorized, got %s", p.collector.name, p)
+		}
+		t.Log(p.collector.name, p)
+	}
+}
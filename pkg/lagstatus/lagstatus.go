@@ -0,0 +1,130 @@
+package lagstatus
+
+// Status is the health of a consumer group on a partition, ordered from the
+// least to the most severe.
+type Status int
+
+const (
+	// OK means the consumer is keeping up, or has no lag at all.
+	OK Status = iota
+	// Warning means the lag grew across the whole window, or is above the
+	// warning threshold.
+	Warning
+	// Error means the lag is above the error threshold.
+	Error
+	// Stop means the committed offset didn't move across the whole window
+	// while there is lag, and nobody is consuming the partition.
+	Stop
+	// Stall means a member is assigned to the partition and keeps committing
+	// the same offset across the whole window while there is lag.
+	Stall
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "OK"
+	case Warning:
+		return "WARNING"
+	case Error:
+		return "ERROR"
+	case Stop:
+		return "STOP"
+	case Stall:
+		return "STALL"
+	}
+	return "UNKNOWN"
+}
+
+// Sample is the state of a consumer group on a partition during one export
+// cycle.
+type Sample struct {
+	Offset int64 // Offset is the committed offset.
+	Lag    int64 // Lag is the number of messages the group is behind.
+	Active bool  // Active is whether a group member is assigned to the partition.
+}
+
+// Thresholds configures when lag alone is enough to degrade the status, zero
+// disables a threshold.
+type Thresholds struct {
+	WarningLag int64
+	ErrorLag   int64
+}
+
+// Window is a sliding window of the most recent samples of a consumer group on
+// a partition, in the spirit of Burrow's consumer lag evaluation rules.
+type Window struct {
+	Size int
+
+	samples []Sample
+}
+
+// Add records a sample, evicting the oldest one once the window is full.
+func (w *Window) Add(s Sample) {
+	if size := max(w.Size, 1); len(w.samples) >= size {
+		w.samples = w.samples[len(w.samples)-size+1:]
+	}
+
+	w.samples = append(w.samples, s)
+}
+
+// Full reports whether the window holds Size samples. Rules looking at how
+// offsets and lag evolve only apply once the window is full, so that a
+// consumer isn't judged on a couple of export cycles.
+func (w *Window) Full() bool {
+	return len(w.samples) >= max(w.Size, 1)
+}
+
+// Evaluate returns the status of the consumer group on the partition.
+func (w *Window) Evaluate(t Thresholds) Status {
+	if len(w.samples) == 0 {
+		return OK
+	}
+
+	latest := w.samples[len(w.samples)-1]
+	if latest.Lag <= 0 {
+		return OK
+	}
+
+	if w.Full() && w.stuck() {
+		if latest.Active {
+			return Stall
+		}
+		return Stop
+	}
+
+	if t.ErrorLag > 0 && latest.Lag >= t.ErrorLag {
+		return Error
+	}
+
+	if t.WarningLag > 0 && latest.Lag >= t.WarningLag {
+		return Warning
+	}
+
+	if w.Full() && w.growing() {
+		return Warning
+	}
+
+	return OK
+}
+
+// stuck reports whether the offset never moved while there was lag.
+func (w *Window) stuck() bool {
+	first := w.samples[0]
+	for _, s := range w.samples {
+		if s.Offset != first.Offset || s.Lag <= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// growing reports whether the lag grew in between every two samples.
+func (w *Window) growing() bool {
+	for i := 1; i < len(w.samples); i++ {
+		if w.samples[i].Lag <= w.samples[i-1].Lag {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,52 @@
+package rate
+
+import (
+	"math"
+	"time"
+)
+
+// Rate is an exponentially weighted moving average of the per second rate at
+// which a monotonically increasing counter, e.g. a partition offset, grows.
+//
+// The state lives in memory only: it carries over from one observation to the
+// next for as long as the Rate is kept around, e.g. across the export cycles
+// of a process, and starts over when the process restarts.
+type Rate struct {
+	// Window is the smoothing window, samples older than the window weigh
+	// less than 1/e in the average. A zero window disables smoothing.
+	Window time.Duration
+
+	value   int64
+	at      time.Time
+	rate    float64
+	samples int
+}
+
+// Observe records the value of the counter at the given time and returns the
+// smoothed rate. ok is false until two samples have been observed. A counter
+// going backwards, e.g. after a topic is recreated, restarts the average.
+func (r *Rate) Observe(value int64, at time.Time) (rate float64, ok bool) {
+	switch {
+	case r.samples == 0, value < r.value:
+		r.value, r.at, r.rate, r.samples = value, at, 0, 1
+		return 0, false
+	case !at.After(r.at):
+		// no time elapsed, so there is nothing to learn from this sample
+		return r.rate, r.samples > 1
+	}
+
+	elapsed := at.Sub(r.at)
+	instant := float64(value-r.value) / elapsed.Seconds()
+
+	if r.samples == 1 || r.Window <= 0 {
+		r.rate = instant
+	} else {
+		alpha := 1 - math.Exp(-elapsed.Seconds()/r.Window.Seconds())
+		r.rate += alpha * (instant - r.rate)
+	}
+
+	r.value, r.at = value, at
+	r.samples++
+
+	return r.rate, true
+}
@@ -0,0 +1,79 @@
+package rate
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRate(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+
+	type observation struct {
+		value   int64
+		seconds int
+		rate    float64
+		ok      bool
+	}
+
+	// alpha of a 10s step with a 10s window
+	alpha := 1 - math.Exp(-1)
+
+	for _, tc := range []struct {
+		name         string
+		window       time.Duration
+		observations []observation
+	}{
+		{
+			name:   "unsmoothed",
+			window: 0,
+			observations: []observation{
+				{value: 0, seconds: 0},
+				{value: 100, seconds: 10, rate: 10, ok: true},
+				{value: 400, seconds: 20, rate: 30, ok: true},
+			},
+		},
+		{
+			name:   "smoothed",
+			window: 10 * time.Second,
+			observations: []observation{
+				{value: 0, seconds: 0},
+				// the first rate is taken as is
+				{value: 100, seconds: 10, rate: 10, ok: true},
+				{value: 400, seconds: 20, rate: 10 + alpha*(30-10), ok: true},
+			},
+		},
+		{
+			name:   "no time elapsed",
+			window: 10 * time.Second,
+			observations: []observation{
+				{value: 0, seconds: 0},
+				{value: 50, seconds: 0},
+				{value: 100, seconds: 10, rate: 10, ok: true},
+				{value: 500, seconds: 10, rate: 10, ok: true},
+			},
+		},
+		{
+			name:   "counter going backwards",
+			window: 10 * time.Second,
+			observations: []observation{
+				{value: 1000, seconds: 0},
+				{value: 1100, seconds: 10, rate: 10, ok: true},
+				// e.g. the topic was recreated
+				{value: 5, seconds: 20},
+				{value: 55, seconds: 30, rate: 5, ok: true},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := &Rate{Window: tc.window}
+			for i, o := range tc.observations {
+				rate, ok := r.Observe(o.value, at(o.seconds))
+				if ok != o.ok || math.Abs(rate-o.rate) > 1e-9 {
+					t.Errorf("observation %d: expected %v %t, got %v %t", i, o.rate, o.ok, rate, ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package remotewrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/klauspost/compress/snappy"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Encode returns the snappy compressed remote write request of the samples,
+// stamped with at.
+//
+// The request is encoded by hand, it only takes a few fields of the
+// prometheus.WriteRequest message.
+func Encode(samples []sink.Sample, at time.Time) []byte {
+	var b []byte
+	for _, s := range samples {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, timeSeries(s, at.UnixMilli()))
+	}
+
+	return snappy.Encode(nil, b)
+}
+
+// timeSeries encodes a prometheus.TimeSeries message of a single sample.
+func timeSeries(s sink.Sample, timestamp int64) []byte {
+	names := make([]string, 0, len(s.Labels)+1)
+	names = append(names, "__name__")
+	for name, value := range s.Labels {
+		// an empty label value is the same as the label missing, and
+		// receivers reject empty ones
+		if value != "" {
+			names = append(names, name)
+		}
+	}
+	// receivers expect labels sorted by name
+	sort.Strings(names)
+
+	var b []byte
+	for _, name := range names {
+		value := s.Name
+		if name != "__name__" {
+			value = s.Labels[name]
+		}
+
+		var label []byte
+		label = protowire.AppendTag(label, 1, protowire.BytesType)
+		label = protowire.AppendString(label, name)
+		label = protowire.AppendTag(label, 2, protowire.BytesType)
+		label = protowire.AppendString(label, value)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, label)
+	}
+
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.Fixed64Type)
+	value = protowire.AppendFixed64(value, math.Float64bits(s.Value))
+	value = protowire.AppendTag(value, 2, protowire.VarintType)
+	value = protowire.AppendVarint(value, uint64(timestamp))
+
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	return protowire.AppendBytes(b, value)
+}
+
+// Client sends remote write requests to a single endpoint.
+type Client struct {
+	URL string
+
+	// Username and Password enable basic authentication, BearerToken takes
+	// precedence over them
+	Username    string
+	Password    string
+	BearerToken string
+
+	HTTP *http.Client
+}
+
+// RecoverableError is returned by Send when the request may succeed if it's
+// sent again, i.e. network errors, 5xx and 429 responses.
+type RecoverableError struct {
+	Err error
+}
+
+func (e RecoverableError) Error() string { return e.Err.Error() }
+func (e RecoverableError) Unwrap() error { return e.Err }
+
+// Recoverable reports whether the request that failed with err may succeed if
+// it's sent again.
+func Recoverable(err error) bool {
+	var re RecoverableError
+	return errors.As(err, &re)
+}
+
+// Send posts an encoded request to the endpoint.
+func (c *Client) Send(ctx context.Context, request []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.URL, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("User-Agent", "kafka-exporter")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	switch {
+	case c.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+	case c.Username != "":
+		req.SetBasicAuth(c.Username, c.Password)
+	}
+
+	client := c.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return RecoverableError{err}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("remote write to %s failed with %s: %s", c.URL, resp.Status, bytes.TrimSpace(body))
+	if resp.StatusCode/100 == 5 || resp.StatusCode == http.StatusTooManyRequests {
+		return RecoverableError{err}
+	}
+	return err
+}
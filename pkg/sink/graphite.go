@@ -0,0 +1,67 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Graphite sends the samples over the Graphite plaintext protocol, the labels
+// that aren't in the path of the template being sent as Graphite tags.
+type Graphite struct {
+	Address   string
+	Templates []Template
+}
+
+func (Graphite) Name() string { return "graphite" }
+
+func (g Graphite) Write(ctx context.Context, samples []Sample, at time.Time) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", g.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+
+	w := bufio.NewWriter(conn)
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	for _, sample := range samples {
+		if !finite(sample.Value) {
+			continue
+		}
+
+		path, tags := Match(g.Templates, sample).Apply(sample)
+
+		_, _ = w.WriteString(graphitePath.Replace(path))
+		for _, k := range sortedKeys(tags) {
+			if tags[k] == "" {
+				continue
+			}
+			_ = w.WriteByte(';')
+			_, _ = w.WriteString(graphiteTag.Replace(k))
+			_ = w.WriteByte('=')
+			_, _ = w.WriteString(graphiteTag.Replace(tags[k]))
+		}
+		_ = w.WriteByte(' ')
+		_, _ = w.WriteString(strconv.FormatFloat(sample.Value, 'f', -1, 64))
+		_ = w.WriteByte(' ')
+		_, _ = w.WriteString(timestamp)
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
+
+var (
+	graphitePath = strings.NewReplacer(" ", "_", ";", "_", "\n", "_")
+	graphiteTag  = strings.NewReplacer(" ", "_", ";", "_", "~", "_", "=", "_", "!", "_", "^", "_", "\n", "_")
+)
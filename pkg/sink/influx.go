@@ -0,0 +1,88 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Influx writes the samples in the InfluxDB line protocol to a write endpoint,
+// the path of the template being the measurement and the labels that aren't in
+// it the tags, with the sample in the value field.
+type Influx struct {
+	// URL is the write endpoint, e.g.
+	// http://localhost:8086/api/v2/write?org=org&bucket=kafka
+	URL   string
+	Token string
+
+	Templates []Template
+	HTTP      *http.Client
+}
+
+func (Influx) Name() string { return "influx" }
+
+func (i Influx) Write(ctx context.Context, samples []Sample, at time.Time) error {
+	var body bytes.Buffer
+	timestamp := strconv.FormatInt(at.UnixNano(), 10)
+	for _, sample := range samples {
+		if !finite(sample.Value) {
+			continue
+		}
+
+		measurement, tags := Match(i.Templates, sample).Apply(sample)
+
+		body.WriteString(influxMeasurement.Replace(measurement))
+		for _, k := range sortedKeys(tags) {
+			// empty tag values aren't allowed
+			if tags[k] == "" {
+				continue
+			}
+			body.WriteByte(',')
+			body.WriteString(influxTag.Replace(k))
+			body.WriteByte('=')
+			body.WriteString(influxTag.Replace(tags[k]))
+		}
+		body.WriteString(" value=")
+		body.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+		body.WriteByte(' ')
+		body.WriteString(timestamp)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, i.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if i.Token != "" {
+		req.Header.Set("Authorization", "Token "+i.Token)
+	}
+
+	client := i.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("influx write to %s failed with %s: %s", i.URL, resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+var (
+	influxMeasurement = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxTag         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
@@ -0,0 +1,193 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Sink is sent the metrics after every export cycle, alongside the Prometheus
+// registry.
+type Sink interface {
+	// Name identifies the sink in logs and metrics.
+	Name() string
+	Write(ctx context.Context, samples []Sample, at time.Time) error
+}
+
+// Sample is a single value of a metric, histograms and summaries having
+// several.
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Flatten returns the samples of the metric families the way they appear in
+// the Prometheus text format: histograms as _bucket, _sum and _count samples,
+// summaries as quantile, _sum and _count samples.
+func Flatten(families []*dto.MetricFamily) []Sample {
+	var samples []Sample
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			samples = append(samples, flatten(family, metric)...)
+		}
+	}
+	return samples
+}
+
+func flatten(family *dto.MetricFamily, metric *dto.Metric) []Sample {
+	labels := make(map[string]string, len(metric.GetLabel()))
+	for _, label := range metric.GetLabel() {
+		labels[label.GetName()] = label.GetValue()
+	}
+
+	with := func(name, value string) map[string]string {
+		l := make(map[string]string, len(labels)+1)
+		for k, v := range labels {
+			l[k] = v
+		}
+		l[name] = value
+		return l
+	}
+
+	name := family.GetName()
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		return []Sample{{Name: name, Labels: labels, Value: metric.GetCounter().GetValue()}}
+	case dto.MetricType_GAUGE:
+		return []Sample{{Name: name, Labels: labels, Value: metric.GetGauge().GetValue()}}
+	case dto.MetricType_UNTYPED:
+		return []Sample{{Name: name, Labels: labels, Value: metric.GetUntyped().GetValue()}}
+	case dto.MetricType_HISTOGRAM:
+		h := metric.GetHistogram()
+		s := make([]Sample, 0, len(h.GetBucket())+3)
+		for _, bucket := range h.GetBucket() {
+			s = append(s, Sample{
+				Name:   name + "_bucket",
+				Labels: with("le", formatFloat(bucket.GetUpperBound())),
+				Value:  float64(bucket.GetCumulativeCount()),
+			})
+		}
+		return append(s,
+			Sample{Name: name + "_bucket", Labels: with("le", "+Inf"), Value: float64(h.GetSampleCount())},
+			Sample{Name: name + "_sum", Labels: labels, Value: h.GetSampleSum()},
+			Sample{Name: name + "_count", Labels: labels, Value: float64(h.GetSampleCount())},
+		)
+	case dto.MetricType_SUMMARY:
+		summary := metric.GetSummary()
+		s := make([]Sample, 0, len(summary.GetQuantile())+2)
+		for _, q := range summary.GetQuantile() {
+			s = append(s, Sample{
+				Name:   name,
+				Labels: with("quantile", formatFloat(q.GetQuantile())),
+				Value:  q.GetValue(),
+			})
+		}
+		return append(s,
+			Sample{Name: name + "_sum", Labels: labels, Value: summary.GetSampleSum()},
+			Sample{Name: name + "_count", Labels: labels, Value: float64(summary.GetSampleCount())},
+		)
+	}
+
+	return nil
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// finite reports whether v can be written by the sinks, none of which support
+// NaN or infinite values.
+func finite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// placeholder matches the {label} placeholders of a template, {__name__} being
+// the metric name.
+var placeholder = regexp.MustCompile(`\{([a-zA-Z_][a-zA-Z0-9_]*)\}`)
+
+// Template maps the labels of the metrics whose name matches into a dotted
+// path, e.g. kafka.{consumergroup}.{topic}.{partition}.{__name__}. Segments
+// referring to a label the sample doesn't have are left out, and the labels
+// that aren't in the path are kept as tags by the sinks supporting them.
+type Template struct {
+	match    *regexp.Regexp
+	segments []string
+}
+
+// DefaultTemplate keeps the metric name as is and every label as a tag.
+var DefaultTemplate = Template{segments: []string{"{__name__}"}}
+
+// UnmarshalText accepts REGEX=TEMPLATE.
+func (t *Template) UnmarshalText(text []byte) error {
+	i := strings.LastIndexByte(string(text), '=')
+	if i < 0 {
+		return fmt.Errorf("invalid template %s, expected REGEX=TEMPLATE", text)
+	}
+
+	match, err := regexp.Compile(string(text[:i]))
+	if err != nil {
+		return fmt.Errorf("invalid template regex: %w", err)
+	}
+
+	segments := strings.Split(string(text[i+1:]), ".")
+	for _, segment := range segments {
+		if segment == "" {
+			return fmt.Errorf("invalid template %s: empty segment", text[i+1:])
+		}
+	}
+
+	*t = Template{match: match, segments: segments}
+	return nil
+}
+
+// Apply returns the path of the sample and its labels that aren't in it.
+func (t Template) Apply(s Sample) (string, map[string]string) {
+	tags := make(map[string]string, len(s.Labels))
+	for k, v := range s.Labels {
+		tags[k] = v
+	}
+
+	path := make([]string, 0, len(t.segments))
+	for _, segment := range t.segments {
+		missing := false
+		segment = placeholder.ReplaceAllStringFunc(segment, func(p string) string {
+			label := p[1 : len(p)-1]
+			if label == "__name__" {
+				return s.Name
+			}
+
+			value, ok := s.Labels[label]
+			if !ok || value == "" {
+				missing = true
+				return ""
+			}
+			delete(tags, label)
+			// the template alone defines the hierarchy of the path
+			return strings.ReplaceAll(value, ".", "_")
+		})
+
+		if !missing {
+			path = append(path, segment)
+		}
+	}
+
+	return strings.Join(path, "."), tags
+}
+
+// Match returns the first template matching the sample name, the default one
+// if none does.
+func Match(templates []Template, s Sample) Template {
+	for _, t := range templates {
+		if t.match.MatchString(s.Name) {
+			return t
+		}
+	}
+	return DefaultTemplate
+}
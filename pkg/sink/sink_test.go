@@ -0,0 +1,147 @@
+package sink
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	var template Template
+	if err := template.UnmarshalText([]byte("^kafka_consumergroup_=kafka.{consumergroup}.{topic}.p{partition}.{__name__}")); err != nil {
+		t.Fatal(err, "failed to parse template")
+	}
+	templates := []Template{template}
+
+	for _, tc := range []struct {
+		name   string
+		sample Sample
+		path   string
+		tags   map[string]string
+	}{
+		{
+			name: "all labels",
+			sample: Sample{
+				Name:   "kafka_consumergroup_lag",
+				Labels: map[string]string{"consumergroup": "billing", "topic": "orders.v1", "partition": "3", "status": "OK"},
+			},
+			path: "kafka.billing.orders_v1.p3.kafka_consumergroup_lag",
+			tags: map[string]string{"status": "OK"},
+		},
+		{
+			name: "missing label",
+			sample: Sample{
+				Name:   "kafka_consumergroup_members",
+				Labels: map[string]string{"consumergroup": "billing"},
+			},
+			path: "kafka.billing.kafka_consumergroup_members",
+			tags: map[string]string{},
+		},
+		{
+			name: "no matching template",
+			sample: Sample{
+				Name:   "kafka_topic_partitions",
+				Labels: map[string]string{"topic": "orders"},
+			},
+			path: "kafka_topic_partitions",
+			tags: map[string]string{"topic": "orders"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path, tags := Match(templates, tc.sample).Apply(tc.sample)
+			if path != tc.path {
+				t.Errorf("expected path %s, got %s", tc.path, path)
+			}
+			if !reflect.DeepEqual(tags, tc.tags) {
+				t.Errorf("expected tags %v, got %v", tc.tags, tags)
+			}
+		})
+	}
+}
+
+func TestSinks(t *testing.T) {
+	samples := []Sample{{
+		Name:   "kafka_topic_partitions",
+		Labels: map[string]string{"topic": "orders"},
+		Value:  3,
+	}}
+	at := time.Unix(1700000000, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("statsd", func(t *testing.T) {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err, "failed to listen")
+		}
+		defer conn.Close()
+
+		if err := (StatsD{Address: conn.LocalAddr().String()}).Write(ctx, samples, at); err != nil {
+			t.Fatal(err, "failed to write to statsd")
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		packet := make([]byte, 1500)
+		n, _, err := conn.ReadFrom(packet)
+		if err != nil {
+			t.Fatal(err, "failed to read packet")
+		}
+		if got := string(packet[:n]); got != "kafka_topic_partitions:3|g|#topic:orders" {
+			t.Error("unexpected statsd packet", got)
+		}
+	})
+
+	t.Run("graphite", func(t *testing.T) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err, "failed to listen")
+		}
+		defer l.Close()
+
+		lines := make(chan string, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- line
+		}()
+
+		if err := (Graphite{Address: l.Addr().String()}).Write(ctx, samples, at); err != nil {
+			t.Fatal(err, "failed to write to graphite")
+		}
+		if got := <-lines; got != "kafka_topic_partitions;topic=orders 3 1700000000\n" {
+			t.Errorf("unexpected graphite line %q", got)
+		}
+	})
+
+	t.Run("influx", func(t *testing.T) {
+		bodies := make(chan string, 1)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Token secret" {
+				t.Error("unexpected authorization header", r.Header.Get("Authorization"))
+			}
+			body, _ := io.ReadAll(r.Body)
+			bodies <- string(body)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		if err := (Influx{URL: server.URL, Token: "secret"}).Write(ctx, samples, at); err != nil {
+			t.Fatal(err, "failed to write to influx")
+		}
+		if got := strings.TrimSpace(<-bodies); got != "kafka_topic_partitions,topic=orders value=3 1700000000000000000" {
+			t.Error("unexpected influx line", got)
+		}
+	})
+}
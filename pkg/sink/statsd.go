@@ -0,0 +1,92 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPacketSize keeps the StatsD packets under the usual MTU.
+const maxPacketSize = 1432
+
+// StatsD sends the samples as DogStatsD gauges over UDP, the labels that aren't
+// in the path of the template being sent as tags.
+type StatsD struct {
+	Address   string
+	Templates []Template
+}
+
+func (StatsD) Name() string { return "statsd" }
+
+func (s StatsD) Write(ctx context.Context, samples []Sample, _ time.Time) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", s.Address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var packet bytes.Buffer
+	for _, sample := range samples {
+		if !finite(sample.Value) {
+			continue
+		}
+
+		path, tags := Match(s.Templates, sample).Apply(sample)
+		line := statsdLine(path, sample.Value, tags)
+
+		if packet.Len() > 0 && packet.Len()+1+len(line) > maxPacketSize {
+			if _, err := conn.Write(packet.Bytes()); err != nil {
+				return err
+			}
+			packet.Reset()
+		}
+
+		if packet.Len() > 0 {
+			packet.WriteByte('\n')
+		}
+		packet.WriteString(line)
+	}
+
+	if packet.Len() > 0 {
+		_, err = conn.Write(packet.Bytes())
+	}
+	return err
+}
+
+var statsdReplacer = strings.NewReplacer(":", "_", "|", "_", "@", "_", ",", "_", "#", "_", "\n", "_")
+
+func statsdLine(path string, value float64, tags map[string]string) string {
+	var b strings.Builder
+	b.WriteString(statsdReplacer.Replace(path))
+	b.WriteByte(':')
+	b.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	b.WriteString("|g")
+
+	keys := sortedKeys(tags)
+	for i, k := range keys {
+		if i == 0 {
+			b.WriteString("|#")
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(statsdReplacer.Replace(k))
+		b.WriteByte(':')
+		b.WriteString(statsdReplacer.Replace(tags[k]))
+	}
+
+	return b.String()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,135 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+// keepAlive is the interval at which a comment is sent to idle streams, so that
+// proxies and load balancers don't close the connection.
+const keepAlive = 15 * time.Second
+
+// Event is a single Server-Sent Event, Data is sent JSON encoded.
+type Event struct {
+	Name string
+	Data any
+}
+
+// Hub fans out published events to every connected Server-Sent Events stream.
+// Publishing never blocks: events are dropped for clients that are too slow to
+// keep up.
+type Hub struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+
+	done chan struct{}
+	once sync.Once
+}
+
+// NewHub creates a Hub without any subscribers.
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[chan Event]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+// Publish sends the event to every subscriber.
+func (h *Hub) Publish(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			log.Warn().Str("event", event.Name).Msg("subscriber is too slow, dropping event")
+		}
+	}
+}
+
+// Close ends every open stream. It is meant to be registered with
+// http.Server.RegisterOnShutdown, since streams never finish on their own.
+func (h *Hub) Close() {
+	h.once.Do(func() { close(h.done) })
+}
+
+// Subscribe returns a channel receiving the events published from now on and
+// a function to unsubscribe, events are dropped once 64 are waiting.
+func (h *Hub) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers, ch)
+		h.mu.Unlock()
+	}
+}
+
+// Handler streams published events to the client. filter is called once per
+// request to build a predicate deciding which events the client receives, it
+// can be nil to send everything.
+func (h *Hub) Handler(filter func(r *http.Request) func(Event) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		accept := func(Event) bool { return true }
+		if filter != nil {
+			accept = filter(r)
+		}
+
+		events, unsubscribe := h.Subscribe()
+		defer unsubscribe()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		t := time.NewTicker(keepAlive)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-h.done:
+				return
+			case <-t.C:
+				if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			case event := <-events:
+				if !accept(event) {
+					continue
+				}
+
+				data, err := json.Marshal(event.Data)
+				if err != nil {
+					log.Error().Err(err).Str("event", event.Name).Msg("failed to encode event")
+					continue
+				}
+
+				if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Name, data); err != nil {
+					return
+				}
+			}
+
+			flusher.Flush()
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package sse
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// next returns the next event of the stream, skipping keep-alive comments.
+func next(t *testing.T, r *bufio.Reader) string {
+	t.Helper()
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err, "failed to read the stream")
+		}
+
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			if len(lines) > 0 {
+				return strings.Join(lines, "\n")
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	server := httptest.NewServer(h.Handler(func(r *http.Request) func(Event) bool {
+		name := r.URL.Query().Get("event")
+		return func(e Event) bool { return name == "" || e.Name == name }
+	}))
+	defer server.Close()
+
+	subscribe := func(query string) (*http.Response, *bufio.Reader) {
+		resp, err := http.Get(server.URL + "?" + query)
+		if err != nil {
+			t.Fatal(err, "failed to subscribe")
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+			t.Fatal("expected an event stream, got", ct)
+		}
+		return resp, bufio.NewReader(resp.Body)
+	}
+
+	all, allEvents := subscribe("")
+	defer all.Body.Close()
+	filtered, filteredEvents := subscribe("event=b")
+	defer filtered.Body.Close()
+
+	h.Publish(Event{Name: "a", Data: map[string]int{"n": 1}})
+	h.Publish(Event{Name: "b", Data: map[string]int{"n": 2}})
+
+	for _, expected := range []string{"event: a\ndata: {\"n\":1}", "event: b\ndata: {\"n\":2}"} {
+		if got := next(t, allEvents); got != expected {
+			t.Errorf("expected %q, got %q", expected, got)
+		}
+	}
+	if got := next(t, filteredEvents); got != "event: b\ndata: {\"n\":2}" {
+		t.Error("expected only the accepted event, got", got)
+	}
+
+	// disconnected clients are unsubscribed
+	filtered.Body.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		h.mu.Lock()
+		n := len(h.subscribers)
+		h.mu.Unlock()
+		if n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the disconnected client to be unsubscribed, got", n, "subscribers")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// closing the hub ends the open streams
+	h.Close()
+	h.Close()
+	done := make(chan error, 1)
+	go func() {
+		_, err := allEvents.ReadString('\n')
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("expected the stream to end")
+		}
+	case <-time.After(time.Second):
+		t.Error("expected the stream to end on close")
+	}
+}
+
+func TestHubSlowSubscriber(t *testing.T) {
+	h := NewHub()
+	ch, unsubscribe := h.Subscribe()
+	defer unsubscribe()
+
+	// publishing never blocks, events past the buffer are dropped
+	for i := 0; i < cap(ch)+10; i++ {
+		h.Publish(Event{Name: "a"})
+	}
+	if len(ch) != cap(ch) {
+		t.Errorf("expected %d buffered events, got %d", cap(ch), len(ch))
+	}
+}
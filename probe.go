@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/fail"
+	"github.com/0xgirish/kafka-exporter/pkg/sse"
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"gopkg.in/yaml.v3"
+)
+
+// probeModule is a named way to authenticate to probe targets.
+type probeModule struct {
+	SASL SASL `yaml:"sasl"`
+	TLS  TLS  `yaml:"tls"`
+}
+
+type probeModules struct {
+	Modules map[string]probeModule `yaml:"modules"`
+}
+
+func loadProbeModules(path string) (map[string]probeModule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var modules probeModules
+	if err := yaml.Unmarshal(b, &modules); err != nil {
+		return nil, fmt.Errorf("invalid probe config %s: %w", path, err)
+	}
+
+	for name, module := range modules.Modules {
+		switch module.SASL.Mechanism {
+		case "":
+			module.SASL.Mechanism = "PLAIN"
+		case "PLAIN", "SCRAM-SHA-256", "SCRAM-SHA-512":
+		default:
+			return nil, fmt.Errorf("invalid sasl mechanism of probe module %s: %s", name, module.SASL.Mechanism)
+		}
+		modules.Modules[name] = module
+	}
+
+	return modules.Modules, nil
+}
+
+// prober serves /probe, collecting the metrics of the cluster passed as target
+// on every request like the blackbox exporter does. The exporter of every
+// target is kept between probes, so that rates and statuses can be computed,
+// until it's idle for too long.
+type prober struct {
+	config  Config
+	modules map[string]probeModule
+
+	mu      sync.Mutex
+	targets map[string]*probeTarget
+}
+
+type probeTarget struct {
+	// mu serializes the probes of the target, which share its exporter
+	mu       sync.Mutex
+	exporter *exporter
+	lastUsed time.Time
+}
+
+func newProber(conf Config) (*prober, error) {
+	p := &prober{config: conf, targets: make(map[string]*probeTarget)}
+
+	if conf.Probe.ConfigFile != "" {
+		modules, err := loadProbeModules(conf.Probe.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		p.modules = modules
+	}
+
+	return p, nil
+}
+
+func (p *prober) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("target") == "" {
+		http.Error(w, "target parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	var servers []Address
+	for _, target := range strings.Split(query.Get("target"), ",") {
+		var address Address
+		if err := address.UnmarshalText([]byte(target)); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		servers = append(servers, address)
+	}
+
+	// the exporter's own credentials are never sent to a target, which is
+	// picked by whoever can reach /probe, only those of the given module are
+	kafka := Kafka{Servers: servers}
+	if name := query.Get("module"); name != "" {
+		module, ok := p.modules[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown module %s", name), http.StatusBadRequest)
+			return
+		}
+		kafka.SASL, kafka.TLS = module.SASL, module.TLS
+	}
+
+	t, err := p.target(query.Get("module")+"/"+query.Get("target"), kafka)
+	switch {
+	case errors.Is(err, errTooManyTargets):
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), p.timeout(r))
+	defer cancel()
+
+	reg := p.probe(ctx, t)
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// timeout returns the time a probe can take, slightly less than the scrape
+// timeout of Prometheus so that the probe result makes it in time.
+func (p *prober) timeout(r *http.Request) time.Duration {
+	seconds, err := strconv.ParseFloat(r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds"), 64)
+	if err != nil || seconds <= 0 {
+		return p.config.Probe.Timeout
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	return max(timeout-p.config.Probe.TimeoutOffset, timeout/2)
+}
+
+// errTooManyTargets is returned for a new target when the clients of
+// --probe.max-targets others are kept.
+var errTooManyTargets = errors.New("too many probe targets")
+
+// target returns the target identified by key, creating its exporter if it
+// isn't cached, and evicts the targets idle for too long.
+func (p *prober) target(key string, kafka Kafka) (*probeTarget, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for k, t := range p.targets {
+		// don't close the client of a target being probed
+		if now.Sub(t.lastUsed) < p.config.Probe.IdleTimeout || !t.mu.TryLock() {
+			continue
+		}
+
+		log.Debug().Str("target", k).Msg("evicting idle probe target")
+		t.exporter.client.Close()
+		delete(p.targets, k)
+		t.mu.Unlock()
+	}
+
+	t, ok := p.targets[key]
+	if !ok {
+		// every target holds a client and its connections
+		if len(p.targets) >= p.config.Probe.MaxTargets {
+			return nil, errTooManyTargets
+		}
+
+		conf := p.config
+		conf.Kafka = kafka
+
+		e, err := newProbeExporter(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		t = &probeTarget{exporter: e}
+		p.targets[key] = t
+	}
+	t.lastUsed = now
+
+	return t, nil
+}
+
+// probe collects the metrics of the target into a fresh registry.
+func (p *prober) probe(ctx context.Context, t *probeTarget) *prometheus.Registry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	reg := prometheus.NewRegistry()
+	e := t.exporter
+	e.metrics = newMetrics(reg, e.config.Metrics)
+	e.onErrors = fail.OnErrors{}
+
+	start := time.Now()
+	err := e.export(ctx)
+	if err == nil {
+		// export records the errors it recovers from rather than returning them
+		err = e.onErrors.Recent()
+	}
+
+	success := 1
+	if err != nil {
+		log.Error().Err(err).Msg("failed to probe target")
+		success = 0
+	}
+
+	probeSuccess := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_success",
+		Help: "1 if the metrics of the target were collected without errors, 0 otherwise",
+	})
+	probeDuration := prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "probe_duration_seconds",
+		Help: "Time to collect the metrics of the target",
+	})
+	e.metrics.registerer(reg).MustRegister(probeSuccess, probeDuration)
+
+	probeSuccess.Set(float64(success))
+	probeDuration.Set(time.Since(start).Seconds())
+
+	return reg
+}
+
+// newProbeExporter returns an exporter of a probe target. Unlike NewExporter
+// it doesn't connect to the target, which may well be down, nor start any of
+// the exporter's own background work.
+func newProbeExporter(conf Config) (*exporter, error) {
+	opts, err := franzOpts(conf, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid target: %w", err)
+	}
+
+	kafka, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exporter{
+		d:       conf.RefreshInterval,
+		client:  kadm.NewClient(kafka),
+		kafka:   kafka,
+		config:  conf,
+		lagging: make(map[lagKey]bool),
+		events:  sse.NewHub(),
+		rates:   newRates(conf.RateWindow),
+		history: newLagHistory(conf.UI.History),
+	}, nil
+}
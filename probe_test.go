@@ -0,0 +1,143 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestLoadProbeModules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "probe.yml")
+	config := `
+modules:
+  prod_scram:
+    sasl:
+      enabled: true
+      username: exporter
+      password: secret
+      mechanism: SCRAM-SHA-512
+    tls:
+      enabled: true
+  plain:
+    sasl:
+      enabled: true
+`
+	if err := os.WriteFile(path, []byte(config), 0o600); err != nil {
+		t.Fatal(err, "failed to write probe config")
+	}
+
+	modules, err := loadProbeModules(path)
+	if err != nil {
+		t.Fatal(err, "failed to load probe config")
+	}
+
+	scram := modules["prod_scram"]
+	if !scram.SASL.Enabled || scram.SASL.Username != "exporter" || scram.SASL.Mechanism != "SCRAM-SHA-512" || !scram.TLS.Enabled {
+		t.Error("unexpected module", scram)
+	}
+	if mechanism := modules["plain"].SASL.Mechanism; mechanism != "PLAIN" {
+		t.Error("expected the mechanism to default to PLAIN, got", mechanism)
+	}
+
+	if err := os.WriteFile(path, []byte("modules: {gssapi: {sasl: {mechanism: GSSAPI}}}"), 0o600); err != nil {
+		t.Fatal(err, "failed to write probe config")
+	}
+	if _, err := loadProbeModules(path); err == nil {
+		t.Error("expected an unsupported mechanism to be rejected")
+	}
+}
+
+func TestProbe(t *testing.T) {
+	c, _ := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "orders"))
+
+	// the exporter's own credentials aren't used for targets without a module
+	p, err := newProber(Config{
+		Kafka:   Kafka{SASL: SASL{Enabled: true, Mechanism: "PLAIN", Username: "exporter", Password: "secret"}},
+		Probe:   Probe{Timeout: 10 * time.Second, IdleTimeout: time.Minute, MaxTargets: 1},
+		Metrics: Metrics{Namespace: "acme", Labels: map[string]string{"env": "prod"}},
+	})
+	if err != nil {
+		t.Fatal(err, "failed to create prober")
+	}
+	target := strings.Join(c.ListenAddrs(), ",")
+
+	probe := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/probe?"+query, nil)
+		r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", "5")
+
+		w := httptest.NewRecorder()
+		p.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		w := probe("target=" + target)
+		if w.Code != http.StatusOK {
+			t.Fatal("expected 200, got", w.Code, w.Body.String())
+		}
+
+		body := w.Body.String()
+		for _, s := range []string{
+			`acme_probe_success{env="prod"} 1`,
+			`acme_probe_duration_seconds{env="prod"}`,
+			`acme_kafka_topic_partitions{env="prod",topic="orders"} 1`,
+		} {
+			if !strings.Contains(body, s) {
+				t.Errorf("expected %q in the probe result", s)
+			}
+		}
+	}
+
+	if len(p.targets) != 1 {
+		t.Error("expected the client of the target to be reused, got", len(p.targets), "targets")
+	}
+
+	for _, query := range []string{"", "target=localhost", "target=" + target + "&module=unknown"} {
+		if w := probe(query); w.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %q, got %d", query, w.Code)
+		}
+	}
+
+	// every target holds a client, so only so many are kept
+	if w := probe("target=localhost:1"); w.Code != http.StatusTooManyRequests {
+		t.Error("expected 429 beyond the maximum number of targets, got", w.Code)
+	}
+
+	// targets idle for longer than the idle timeout are evicted on the next
+	// probe
+	idle := p.targets["/"+target]
+	idle.lastUsed = time.Now().Add(-time.Hour)
+	probe("target=" + target)
+	if p.targets["/"+target] == idle {
+		t.Error("expected the idle target to be evicted")
+	}
+}
+
+func TestProbeTimeout(t *testing.T) {
+	p := &prober{config: Config{Probe: Probe{Timeout: 10 * time.Second, TimeoutOffset: 500 * time.Millisecond}}}
+
+	for _, tc := range []struct {
+		header   string
+		expected time.Duration
+	}{
+		{header: "", expected: 10 * time.Second},
+		{header: "invalid", expected: 10 * time.Second},
+		{header: "5", expected: 4500 * time.Millisecond},
+		{header: "0.5", expected: 250 * time.Millisecond},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/probe", nil)
+		if tc.header != "" {
+			r.Header.Set("X-Prometheus-Scrape-Timeout-Seconds", tc.header)
+		}
+
+		if got := p.timeout(r); got != tc.expected {
+			t.Errorf("expected %s for %q, got %s", tc.expected, tc.header, got)
+		}
+	}
+}
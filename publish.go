@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/linkedin/goavro/v2"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// publishedSample is a consumer group lag sample or a topic offset sample
+// published to Kafka.
+type publishedSample struct {
+	Type      string `json:"type"`
+	Cluster   string `json:"cluster"`
+	Group     string `json:"group,omitempty"`
+	Topic     string `json:"topic"`
+	Partition int32  `json:"partition"`
+	// Offset is the committed offset of lag samples, nil when the group has
+	// no committed offset, and the end offset of offset samples
+	Offset *int64 `json:"offset,omitempty"`
+	Lag    *int64 `json:"lag,omitempty"`
+	// Timestamp is in milliseconds since the epoch
+	Timestamp int64 `json:"timestamp"`
+}
+
+const (
+	lagSample    = "lag"
+	offsetSample = "offset"
+)
+
+// key keeps every sample of a group partition, or of a topic partition, on
+// the same partition, so that the topic can be compacted.
+func (s publishedSample) key() []byte {
+	if s.Type == lagSample {
+		return []byte(fmt.Sprintf("%s/%s/%s/%s/%d", s.Type, s.Cluster, s.Group, s.Topic, s.Partition))
+	}
+	return []byte(fmt.Sprintf("%s/%s/%s/%d", s.Type, s.Cluster, s.Topic, s.Partition))
+}
+
+// publishedSampleSchema is the Avro schema of the published samples, which
+// are encoded as Avro single-object encoding.
+const publishedSampleSchema = `{
+	"type": "record",
+	"name": "Sample",
+	"namespace": "kafka_exporter",
+	"fields": [
+		{"name": "type", "type": "string"},
+		{"name": "cluster", "type": "string"},
+		{"name": "group", "type": ["null", "string"], "default": null},
+		{"name": "topic", "type": "string"},
+		{"name": "partition", "type": "int"},
+		{"name": "offset", "type": ["null", "long"], "default": null},
+		{"name": "lag", "type": ["null", "long"], "default": null},
+		{"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}}
+	]
+}`
+
+// sampleEncoder encodes a sample in one of the --publish.format formats.
+type sampleEncoder func(publishedSample) ([]byte, error)
+
+func newSampleEncoder(format string) (sampleEncoder, error) {
+	switch format {
+	case "json":
+		return func(s publishedSample) ([]byte, error) { return json.Marshal(s) }, nil
+	case "avro":
+		codec, err := goavro.NewCodec(publishedSampleSchema)
+		if err != nil {
+			return nil, err
+		}
+		return func(s publishedSample) ([]byte, error) { return codec.SingleFromNative(nil, s.avro()) }, nil
+	case "protobuf":
+		return func(s publishedSample) ([]byte, error) { return s.protobuf(), nil }, nil
+	}
+	return nil, fmt.Errorf("unknown publish format: %s", format)
+}
+
+func (s publishedSample) avro() map[string]any {
+	native := map[string]any{
+		"type":      s.Type,
+		"cluster":   s.Cluster,
+		"group":     nil,
+		"topic":     s.Topic,
+		"partition": s.Partition,
+		"offset":    nil,
+		"lag":       nil,
+		"timestamp": time.UnixMilli(s.Timestamp),
+	}
+	if s.Group != "" {
+		native["group"] = goavro.Union("string", s.Group)
+	}
+	if s.Offset != nil {
+		native["offset"] = goavro.Union("long", *s.Offset)
+	}
+	if s.Lag != nil {
+		native["lag"] = goavro.Union("long", *s.Lag)
+	}
+	return native
+}
+
+// protobuf encodes the sample as the following message:
+//
+//	message Sample {
+//	  string type = 1;
+//	  string cluster = 2;
+//	  string group = 3;
+//	  string topic = 4;
+//	  int32 partition = 5;
+//	  optional int64 offset = 6;
+//	  optional int64 lag = 7;
+//	  int64 timestamp = 8;
+//	}
+func (s publishedSample) protobuf() []byte {
+	var b []byte
+	for _, field := range []struct {
+		number protowire.Number
+		value  string
+	}{{1, s.Type}, {2, s.Cluster}, {3, s.Group}, {4, s.Topic}} {
+		if field.value != "" {
+			b = protowire.AppendTag(b, field.number, protowire.BytesType)
+			b = protowire.AppendString(b, field.value)
+		}
+	}
+
+	b = protowire.AppendTag(b, 5, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(s.Partition))
+	if s.Offset != nil {
+		b = protowire.AppendTag(b, 6, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*s.Offset))
+	}
+	if s.Lag != nil {
+		b = protowire.AppendTag(b, 7, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*s.Lag))
+	}
+	b = protowire.AppendTag(b, 8, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(s.Timestamp))
+}
+
+// publisher is a sink producing the consumer group lag and topic offset
+// samples of every export cycle to a Kafka topic, possibly of another cluster.
+type publisher struct {
+	client *kgo.Client
+	encode sampleEncoder
+	// prefix is prepended to the name of every metric
+	prefix string
+	// timeout bounds the flush of the records still buffered on close
+	timeout time.Duration
+}
+
+func newPublisher(conf Config) (*publisher, error) {
+	encode, err := newSampleEncoder(conf.Publish.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	target := conf
+	if len(conf.Publish.KafkaServers) > 0 {
+		target = Config{Kafka: conf.Publish.kafka()}
+	}
+
+	opts, err := franzOpts(target, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the samples of a cycle are stale by the next one, don't let them
+	// linger in the client's buffer past the sink timeout
+	client, err := kgo.NewClient(append(opts,
+		kgo.DefaultProduceTopic(conf.Publish.Topic),
+		kgo.RecordDeliveryTimeout(conf.Sinks.Timeout),
+	)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publisher{client: client, encode: encode, prefix: conf.Metrics.prefix(), timeout: conf.Sinks.Timeout}, nil
+}
+
+func (*publisher) Name() string { return "kafka" }
+
+// Close flushes the records still buffered, for at most the sink timeout, and
+// closes the client.
+func (p *publisher) Close() error {
+	defer p.client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+
+	return p.client.Flush(ctx)
+}
+
+// Write produces the samples and waits for them to be acknowledged, or for ctx
+// to be done. It runs on the publisher's own sink queue, so waiting holds up
+// neither the export cycles nor the other sinks.
+func (p *publisher) Write(ctx context.Context, samples []sink.Sample, at time.Time) error {
+	published := publishedSamples(samples, p.prefix, at)
+
+	records := make([]*kgo.Record, 0, len(published))
+	for _, s := range published {
+		value, err := p.encode(s)
+		if err != nil {
+			return err
+		}
+		records = append(records, &kgo.Record{Key: s.key(), Value: value, Timestamp: at})
+	}
+
+	return p.client.ProduceSync(ctx, records...).FirstErr()
+}
+
+// publishedSamples picks the consumer group lag and topic offset samples out
+// of the exported samples, whose names start with prefix.
+func publishedSamples(samples []sink.Sample, prefix string, at time.Time) []publishedSample {
+	type groupPartition struct {
+		group, topic, partition string
+	}
+
+	var (
+		cluster string
+		offsets = make(map[groupPartition]int64)
+	)
+	for _, s := range samples {
+		switch strings.TrimPrefix(s.Name, prefix) {
+		case "kafka_cluster_info":
+			cluster = s.Labels["cluster_id"]
+		case "kafka_consumergroup_current_offset":
+			offsets[groupPartition{s.Labels["consumergroup"], s.Labels["topic"], s.Labels["partition"]}] = int64(s.Value)
+		}
+	}
+
+	var published []publishedSample
+	for _, s := range samples {
+		partition, err := strconv.ParseInt(s.Labels["partition"], 10, 32)
+		if err != nil {
+			continue
+		}
+
+		sample := publishedSample{
+			Cluster:   cluster,
+			Topic:     s.Labels["topic"],
+			Partition: int32(partition),
+			Timestamp: at.UnixMilli(),
+		}
+
+		switch strings.TrimPrefix(s.Name, prefix) {
+		case "kafka_consumergroup_lag":
+			lag := int64(s.Value)
+			sample.Type = lagSample
+			sample.Group = s.Labels["consumergroup"]
+			if offset, ok := offsets[groupPartition{sample.Group, s.Labels["topic"], s.Labels["partition"]}]; ok {
+				sample.Offset = &offset
+			}
+			sample.Lag = &lag
+		case "kafka_topic_partition_current_offset":
+			offset := int64(s.Value)
+			sample.Type = offsetSample
+			sample.Offset = &offset
+		default:
+			continue
+		}
+
+		published = append(published, sample)
+	}
+
+	return published
+}
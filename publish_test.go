@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/linkedin/goavro/v2"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestPublish(t *testing.T) {
+	c, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "samples"))
+
+	conf.Publish = Publish{Topic: "samples", Format: "json"}
+	conf.Sinks.Timeout = 10 * time.Second
+
+	p, err := newPublisher(conf)
+	if err != nil {
+		t.Fatal(err, "failed to create publisher")
+	}
+	defer func() {
+		if err := p.Close(); err != nil {
+			t.Error(err, "failed to close publisher")
+		}
+	}()
+
+	// the delivery timeout counts from the record timestamp, the cycle time
+	at := time.UnixMilli(time.Now().UnixMilli())
+	samples := []sink.Sample{
+		{Name: "kafka_cluster_info", Labels: map[string]string{"cluster_id": "test"}, Value: 1},
+		{Name: "kafka_consumergroup_lag", Labels: map[string]string{"consumergroup": "billing", "topic": "orders", "partition": "0"}, Value: 5},
+		{Name: "kafka_consumergroup_current_offset", Labels: map[string]string{"consumergroup": "billing", "topic": "orders", "partition": "0"}, Value: 95},
+		{Name: "kafka_topic_partition_current_offset", Labels: map[string]string{"topic": "orders", "partition": "0"}, Value: 100},
+		{Name: "kafka_consumergroup_lag", Labels: map[string]string{"consumergroup": "billing", "topic": "orders", "partition": "1"}, Value: 7},
+		{Name: "kafka_topic_partitions", Labels: map[string]string{"topic": "orders"}, Value: 1},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := p.Write(ctx, samples, at); err != nil {
+		t.Fatal(err, "failed to publish samples")
+	}
+
+	consumer, err := kgo.NewClient(kgo.SeedBrokers(c.ListenAddrs()...), kgo.ConsumeTopics("samples"))
+	if err != nil {
+		t.Fatal(err, "failed to create consumer")
+	}
+	defer consumer.Close()
+
+	published := make(map[string]publishedSample)
+	for len(published) < 3 && ctx.Err() == nil {
+		consumer.PollFetches(ctx).EachRecord(func(r *kgo.Record) {
+			var s publishedSample
+			if err := json.Unmarshal(r.Value, &s); err != nil {
+				t.Error(err, "failed to decode sample")
+			}
+			published[string(r.Key)] = s
+		})
+	}
+
+	lag, ok := published["lag/test/billing/orders/0"]
+	if !ok || lag.Offset == nil || *lag.Offset != 95 || lag.Lag == nil || *lag.Lag != 5 || lag.Timestamp != at.UnixMilli() {
+		t.Errorf("unexpected lag sample %+v", lag)
+	}
+
+	// a group without a committed offset on the partition has no offset
+	uncommitted, ok := published["lag/test/billing/orders/1"]
+	if !ok || uncommitted.Offset != nil || uncommitted.Lag == nil || *uncommitted.Lag != 7 {
+		t.Errorf("unexpected uncommitted lag sample %+v", uncommitted)
+	}
+
+	offset, ok := published["offset/test/orders/0"]
+	if !ok || offset.Offset == nil || *offset.Offset != 100 || offset.Lag != nil {
+		t.Errorf("unexpected offset sample %+v", offset)
+	}
+}
+
+func TestPublishAvro(t *testing.T) {
+	encode, err := newSampleEncoder("avro")
+	if err != nil {
+		t.Fatal(err, "failed to create encoder")
+	}
+
+	lag := int64(5)
+	value, err := encode(publishedSample{Type: lagSample, Cluster: "test", Group: "billing", Topic: "orders", Lag: &lag, Timestamp: 1700000000000})
+	if err != nil {
+		t.Fatal(err, "failed to encode sample")
+	}
+
+	codec, err := goavro.NewCodec(publishedSampleSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	native, _, err := codec.NativeFromSingle(value)
+	if err != nil {
+		t.Fatal(err, "failed to decode sample")
+	}
+
+	record := native.(map[string]any)
+	if record["group"].(map[string]any)["string"] != "billing" || record["offset"] != nil || record["lag"].(map[string]any)["long"] != int64(5) {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestPublishUnreachable(t *testing.T) {
+	c, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.SeedTopics(1, "samples"))
+
+	conf.Publish = Publish{Topic: "samples", Format: "json"}
+
+	p, err := newPublisher(conf)
+	if err != nil {
+		t.Fatal(err, "failed to create publisher")
+	}
+	defer p.client.Close()
+	c.Close()
+
+	samples := []sink.Sample{
+		{Name: "kafka_topic_partition_current_offset", Labels: map[string]string{"topic": "orders", "partition": "0"}, Value: 100},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := p.Write(ctx, samples, time.Now()); err == nil {
+		t.Fatal("expected publishing to an unreachable cluster to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Error("expected publishing to give up at the deadline, took", elapsed)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// metadataTopic is the internal topic backing the KRaft metadata log.
+const metadataTopic = "__cluster_metadata"
+
+// describeQuorumRequest returns a DescribeQuorum request for the metadata log.
+func describeQuorumRequest() *kmsg.DescribeQuorumRequest {
+	req := kmsg.NewPtrDescribeQuorumRequest()
+	topic := kmsg.NewDescribeQuorumRequestTopic()
+	topic.Topic = metadataTopic
+	topic.Partitions = append(topic.Partitions, kmsg.NewDescribeQuorumRequestTopicPartition())
+	req.Topics = append(req.Topics, topic)
+	return req
+}
+
+// exportQuorum exports the state of the KRaft controller quorum using
+// DescribeQuorum and returns the leader of the quorum. ZooKeeper based
+// clusters don't support the request, in which case nothing is exported and
+// the leader is -1.
+func (e *exporter) exportQuorum(ctx context.Context) (int32, error) {
+	resp, err := describeQuorumRequest().RequestWith(ctx, e.kafka)
+	if err != nil {
+		if unsupported(err) {
+			log.Debug().Err(err).Msg("cluster does not support describe quorum, skipping quorum metrics")
+			e.resetQuorum()
+			return -1, nil
+		}
+		return -1, err
+	}
+
+	if err := kerr.ErrorForCode(resp.ErrorCode); err != nil {
+		return -1, err
+	}
+
+	e.metrics.quorum.logEndOffset.Reset()
+	e.metrics.quorum.lag.Reset()
+	e.metrics.quorum.lastFetch.Reset()
+	e.metrics.quorum.lastCaughtUp.Reset()
+
+	leader := int32(-1)
+	for _, topic := range resp.Topics {
+		for _, partition := range topic.Partitions {
+			if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
+				return -1, err
+			}
+
+			leader = partition.LeaderID
+			e.metrics.quorum.leader.WithLabelValues().Set(float64(partition.LeaderID))
+			e.metrics.quorum.leaderEpoch.WithLabelValues().Set(float64(partition.LeaderEpoch))
+			e.metrics.quorum.highWatermark.WithLabelValues().Set(float64(partition.HighWatermark))
+
+			// lag is relative to the leader's log end offset, the high watermark is
+			// only a fallback for when the leader is missing from the voters
+			leaderEndOffset := partition.HighWatermark
+			for _, voter := range partition.CurrentVoters {
+				if voter.ReplicaID == partition.LeaderID {
+					leaderEndOffset = voter.LogEndOffset
+				}
+			}
+
+			replicaMetrics := func(replicas []kmsg.DescribeQuorumResponseTopicPartitionReplicaState, role string) {
+				for _, replica := range replicas {
+					labels := prometheus.Labels{
+						"replica": strconv.Itoa(int(replica.ReplicaID)),
+						"role":    role,
+					}
+
+					e.metrics.quorum.logEndOffset.With(labels).Set(float64(replica.LogEndOffset))
+					e.metrics.quorum.lag.With(labels).Set(float64(max(0, leaderEndOffset-replica.LogEndOffset)))
+
+					// timestamps are only present from v1 onwards and are -1 when unknown
+					if replica.LastFetchTimestamp >= 0 {
+						e.metrics.quorum.lastFetch.With(labels).Set(float64(replica.LastFetchTimestamp) / 1000)
+					}
+
+					if replica.LastCaughtUpTimestamp >= 0 {
+						e.metrics.quorum.lastCaughtUp.With(labels).Set(float64(replica.LastCaughtUpTimestamp) / 1000)
+					}
+				}
+			}
+
+			replicaMetrics(partition.CurrentVoters, "voter")
+			replicaMetrics(partition.Observers, "observer")
+		}
+	}
+
+	return leader, nil
+}
+
+// resetQuorum removes every quorum metric for clusters without a metadata
+// quorum.
+func (e *exporter) resetQuorum() {
+	e.metrics.quorum.leader.Reset()
+	e.metrics.quorum.leaderEpoch.Reset()
+	e.metrics.quorum.highWatermark.Reset()
+	e.metrics.quorum.logEndOffset.Reset()
+	e.metrics.quorum.lag.Reset()
+	e.metrics.quorum.lastFetch.Reset()
+	e.metrics.quorum.lastCaughtUp.Reset()
+}
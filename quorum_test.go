@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestQuorumUnsupported(t *testing.T) {
+	// kfake, like ZooKeeper based clusters, doesn't support DescribeQuorum
+	_, conf := newTestCluster(t, kfake.NumBrokers(1))
+
+	client, kafka, err := conf.Franzgo(nil)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	e := &exporter{config: conf, metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), client: client, kafka: kafka}
+
+	// a leader left over from before doesn't survive either
+	e.metrics.quorum.leader.WithLabelValues().Set(1)
+
+	leader, err := e.exportQuorum(context.Background())
+	if err != nil {
+		t.Fatal("expected an unsupported DescribeQuorum to be skipped, got", err)
+	}
+	if leader != -1 {
+		t.Error("expected no quorum leader, got", leader)
+	}
+
+	for name, vec := range map[string]*prometheus.GaugeVec{
+		"leader":         e.metrics.quorum.leader,
+		"leader epoch":   e.metrics.quorum.leaderEpoch,
+		"high watermark": e.metrics.quorum.highWatermark,
+		"log end offset": e.metrics.quorum.logEndOffset,
+		"lag":            e.metrics.quorum.lag,
+	} {
+		if n := testutil.CollectAndCount(vec); n != 0 {
+			t.Errorf("expected no quorum %s series, got %d", name, n)
+		}
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	for _, tc := range []struct {
+		err      error
+		expected bool
+	}{
+		{err: kerr.UnsupportedVersion, expected: true},
+		{err: errors.New("unable to request: request key is unknown"), expected: true},
+		{err: errors.New("broker is too old; the broker has already indicated it will not know how to handle the request"), expected: true},
+		{err: kerr.ClusterAuthorizationFailed},
+		{err: context.DeadlineExceeded},
+	} {
+		if got := unsupported(tc.err); got != tc.expected {
+			t.Errorf("expected %t for %v, got %t", tc.expected, tc.err, got)
+		}
+	}
+}
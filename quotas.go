@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// defaultEntity is the label value of quota entity components that apply to
+// every user, client ID or IP without a more specific quota.
+const defaultEntity = "<default>"
+
+// quotaLabels maps the components of a quota entity to the user, client_id and
+// ip labels, leaving the labels of missing components empty.
+func quotaLabels(entity kadm.ClientQuotaEntity) prometheus.Labels {
+	labels := prometheus.Labels{"user": "", "client_id": "", "ip": ""}
+	for _, component := range entity {
+		name := defaultEntity
+		if component.Name != nil {
+			name = *component.Name
+		}
+
+		switch component.Type {
+		case "user":
+			labels["user"] = name
+		case "client-id":
+			labels["client_id"] = name
+		case "ip":
+			labels["ip"] = name
+		}
+	}
+	return labels
+}
+
+// exportQuotas exports the configured client quotas of every entity and the
+// SCRAM credentials of every user.
+func (e *exporter) exportQuotas(ctx context.Context) error {
+	// a non strict describe without components matches every entity
+	quotas, err := e.client.DescribeClientQuotas(ctx, false, nil)
+	switch {
+	case err == nil:
+	case unsupported(err):
+		log.Debug().Err(err).Msg("cluster does not support describe client quotas, skipping quota metrics")
+	default:
+		return err
+	}
+
+	e.metrics.quota.clientQuota.Reset()
+	for _, quota := range quotas {
+		labels := quotaLabels(quota.Entity)
+		for _, value := range quota.Values {
+			labels["key"] = value.Key
+			e.metrics.quota.clientQuota.With(labels).Set(value.Value)
+		}
+	}
+
+	users, err := e.client.DescribeUserSCRAMs(ctx)
+	switch {
+	case err == nil:
+	case unsupported(err):
+		log.Debug().Err(err).Msg("cluster does not support describe user scram credentials, skipping scram metrics")
+		return nil
+	default:
+		return err
+	}
+
+	e.metrics.quota.scramIterations.Reset()
+	for _, user := range users.Sorted() {
+		if user.Err != nil {
+			log.Error().Err(user.Err).Str("user", user.User).Msg("failed to describe user scram credentials")
+			e.onErrors.Record(user.Err)
+			continue
+		}
+
+		for _, cred := range user.CredInfos {
+			e.metrics.quota.scramIterations.With(prometheus.Labels{
+				"user":      user.User,
+				"mechanism": cred.Mechanism.String(),
+			}).Set(float64(cred.Iterations))
+		}
+	}
+
+	return nil
+}
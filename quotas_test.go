@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestQuotaLabels(t *testing.T) {
+	name := func(s string) *string { return &s }
+
+	for _, tc := range []struct {
+		entity   kadm.ClientQuotaEntity
+		expected prometheus.Labels
+	}{
+		{
+			entity:   kadm.ClientQuotaEntity{{Type: "user", Name: name("alice")}},
+			expected: prometheus.Labels{"user": "alice", "client_id": "", "ip": ""},
+		},
+		{
+			entity:   kadm.ClientQuotaEntity{{Type: "user", Name: name("alice")}, {Type: "client-id", Name: name("billing")}},
+			expected: prometheus.Labels{"user": "alice", "client_id": "billing", "ip": ""},
+		},
+		{
+			entity:   kadm.ClientQuotaEntity{{Type: "client-id"}},
+			expected: prometheus.Labels{"user": "", "client_id": defaultEntity, "ip": ""},
+		},
+		{
+			entity:   kadm.ClientQuotaEntity{{Type: "ip", Name: name("10.0.0.1")}},
+			expected: prometheus.Labels{"user": "", "client_id": "", "ip": "10.0.0.1"},
+		},
+		{
+			entity:   kadm.ClientQuotaEntity{{Type: "unknown", Name: name("x")}},
+			expected: prometheus.Labels{"user": "", "client_id": "", "ip": ""},
+		},
+	} {
+		if got := quotaLabels(tc.entity); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("expected %v for %v, got %v", tc.expected, tc.entity, got)
+		}
+	}
+}
+
+func TestExportSCRAMIterations(t *testing.T) {
+	// kfake doesn't support DescribeClientQuotas, which must be skipped
+	_, conf := newTestCluster(t, kfake.NumBrokers(1))
+
+	client, kafka, err := conf.Franzgo(nil)
+	if err != nil {
+		t.Fatal(err, "failed to create client")
+	}
+	defer client.Close()
+
+	e := &exporter{config: conf, metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), client: client, kafka: kafka}
+
+	ctx := context.Background()
+	// a request may only refer to a user once
+	for _, upsert := range []kadm.UpsertSCRAM{
+		{User: "alice", Mechanism: kadm.ScramSha256, Iterations: 8192, Password: "secret"},
+		{User: "alice", Mechanism: kadm.ScramSha512, Iterations: 4096, Password: "secret"},
+	} {
+		altered, err := e.client.AlterUserSCRAMs(ctx, nil, []kadm.UpsertSCRAM{upsert})
+		if err == nil {
+			err = altered.Error()
+		}
+		if err != nil {
+			t.Fatal(err, "failed to create scram credentials")
+		}
+	}
+
+	if err := e.exportQuotas(ctx); err != nil {
+		t.Fatal(err, "failed to export quotas")
+	}
+
+	if n := testutil.CollectAndCount(e.metrics.quota.clientQuota); n != 0 {
+		t.Error("expected no client quota series, got", n)
+	}
+	for mechanism, expected := range map[string]float64{"SCRAM-SHA-256": 8192, "SCRAM-SHA-512": 4096} {
+		got := testutil.ToFloat64(e.metrics.quota.scramIterations.With(prometheus.Labels{"user": "alice", "mechanism": mechanism}))
+		if got != expected {
+			t.Errorf("expected %v iterations for %s, got %v", expected, mechanism, got)
+		}
+	}
+}
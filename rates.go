@@ -0,0 +1,150 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/rate"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// partitionKey identifies a single partition of a topic.
+type partitionKey struct {
+	topic     string
+	partition int32
+}
+
+// rates keeps the moving averages of produce and consume rates across export
+// cycles. Entries that weren't observed in the last cycle are dropped by sweep.
+type rates struct {
+	window time.Duration
+
+	produce map[partitionKey]*rate.Rate
+	consume map[lagKey]*rate.Rate
+
+	seenProduce map[partitionKey]bool
+	seenConsume map[lagKey]bool
+}
+
+func newRates(window time.Duration) *rates {
+	return &rates{
+		window:      window,
+		produce:     make(map[partitionKey]*rate.Rate),
+		consume:     make(map[lagKey]*rate.Rate),
+		seenProduce: make(map[partitionKey]bool),
+		seenConsume: make(map[lagKey]bool),
+	}
+}
+
+// observeProduce records the end offset of a partition and exports the rate at
+// which messages are produced to it.
+func (e *exporter) observeProduce(key partitionKey, endOffset int64, at time.Time) {
+	r, ok := e.rates.produce[key]
+	if !ok {
+		r = &rate.Rate{Window: e.rates.window}
+		e.rates.produce[key] = r
+	}
+	e.rates.seenProduce[key] = true
+
+	if perSecond, ok := r.Observe(endOffset, at); ok {
+		e.metrics.topic.partitionProduceRate.With(prometheus.Labels{
+			"topic":     key.topic,
+			"partition": strconv.Itoa(int(key.partition)),
+		}).Set(perSecond)
+	}
+}
+
+// observeConsume records the committed offset of a group on a partition,
+// exports the rate at which the group consumes it and returns the estimated
+// seconds for the group to consume its lag on the partition at that rate.
+// ok is false until the rate is known.
+func (e *exporter) observeConsume(key lagKey, committed, lag int64, at time.Time) (catchUp float64, ok bool) {
+	r, found := e.rates.consume[key]
+	if !found {
+		r = &rate.Rate{Window: e.rates.window}
+		e.rates.consume[key] = r
+	}
+	e.rates.seenConsume[key] = true
+
+	perSecond, ok := r.Observe(committed, at)
+	if !ok {
+		return 0, false
+	}
+
+	e.metrics.group.consumeRate.With(prometheus.Labels{
+		"consumergroup": key.group,
+		"topic":         key.topic,
+		"partition":     strconv.Itoa(int(key.partition)),
+	}).Set(perSecond)
+
+	switch {
+	case lag <= 0:
+		return 0, true
+	case perSecond <= 0:
+		// not consuming at all, it'll never catch up at this rate
+		return math.Inf(1), true
+	default:
+		return float64(lag) / perSecond, true
+	}
+}
+
+// keepConsumeRates marks the consume rates of a group as observed, so that a
+// group that couldn't be fetched or described keeps its averages until it
+// recovers.
+func (e *exporter) keepConsumeRates(group string) {
+	for key := range e.rates.consume {
+		if key.group == group {
+			e.rates.seenConsume[key] = true
+		}
+	}
+}
+
+// sweepRates forgets the partitions and group partitions that weren't observed
+// since the previous sweep, e.g. deleted topics or groups, along with the
+// catch-up estimate of the groups gone entirely. Produce rates are only swept
+// when the end offsets were listed, so that a failed listing doesn't restart
+// every average.
+func (e *exporter) sweepRates(listedEndOffsets bool) {
+	if listedEndOffsets {
+		for key := range e.rates.produce {
+			if !e.rates.seenProduce[key] {
+				delete(e.rates.produce, key)
+				e.metrics.topic.partitionProduceRate.Delete(prometheus.Labels{
+					"topic":     key.topic,
+					"partition": strconv.Itoa(int(key.partition)),
+				})
+			}
+		}
+	}
+
+	swept := make(map[string]bool)
+	for key := range e.rates.consume {
+		if !e.rates.seenConsume[key] {
+			delete(e.rates.consume, key)
+			e.metrics.group.consumeRate.Delete(prometheus.Labels{
+				"consumergroup": key.group,
+				"topic":         key.topic,
+				"partition":     strconv.Itoa(int(key.partition)),
+			})
+			swept[key.group] = true
+		}
+	}
+
+	// the catch-up estimate is per group, drop it once none of the partitions
+	// of the group is observed anymore
+	for key := range e.rates.consume {
+		delete(swept, key.group)
+	}
+	for group := range swept {
+		e.metrics.group.catchUp.Delete(prometheus.Labels{"consumergroup": group})
+	}
+
+	e.rates.clearSeen()
+}
+
+// clearSeen forgets what was observed since the previous sweep.
+func (r *rates) clearSeen() {
+	clear(r.seenProduce)
+	clear(r.seenConsume)
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestObserveConsume(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	key := lagKey{group: "billing", topic: "orders", partition: 0}
+
+	for _, tc := range []struct {
+		name      string
+		committed int64
+		lag       int64
+		catchUp   float64
+	}{
+		// 100 messages consumed in 10s
+		{name: "lagging", committed: 100, lag: 50, catchUp: 5},
+		{name: "caught up", committed: 100, lag: 0, catchUp: 0},
+		{name: "not consuming", committed: 0, lag: 50, catchUp: math.Inf(1)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			e := &exporter{metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), rates: newRates(0)}
+
+			if _, ok := e.observeConsume(key, 0, tc.lag, start); ok {
+				t.Error("expected no estimate before the rate is known")
+			}
+
+			catchUp, ok := e.observeConsume(key, tc.committed, tc.lag, start.Add(10*time.Second))
+			if !ok || catchUp != tc.catchUp {
+				t.Errorf("expected %v, got %v %t", tc.catchUp, catchUp, ok)
+			}
+
+			if rate := testutil.ToFloat64(e.metrics.group.consumeRate.WithLabelValues("billing", "orders", "0")); rate != float64(tc.committed)/10 {
+				t.Error("expected the consume rate to be exported, got", rate)
+			}
+		})
+	}
+}
+
+func TestSweepRates(t *testing.T) {
+	e := &exporter{metrics: newMetrics(prometheus.NewRegistry(), Metrics{}), rates: newRates(0)}
+	start := time.Unix(1700000000, 0)
+
+	observe := func(at time.Time, partitions []partitionKey, groups []lagKey) {
+		for _, key := range partitions {
+			e.observeProduce(key, at.Unix(), at)
+		}
+		for _, key := range groups {
+			e.observeConsume(key, at.Unix(), 1, at)
+			e.metrics.group.catchUp.WithLabelValues(key.group).Set(1)
+		}
+	}
+
+	orders, payments := partitionKey{topic: "orders"}, partitionKey{topic: "payments"}
+	billing, shipping0, shipping1 := lagKey{group: "billing", topic: "orders"}, lagKey{group: "shipping", topic: "orders"}, lagKey{group: "shipping", topic: "orders", partition: 1}
+
+	for i := 0; i < 2; i++ {
+		observe(start.Add(time.Duration(i)*time.Second), []partitionKey{orders, payments}, []lagKey{billing, shipping0, shipping1})
+		e.sweepRates(true)
+	}
+
+	// payments was deleted, billing is gone and shipping stopped consuming
+	// one of its partitions
+	observe(start.Add(2*time.Second), []partitionKey{orders}, []lagKey{shipping0})
+	e.sweepRates(true)
+
+	for name, collector := range map[string]prometheus.Collector{
+		"produce rate": e.metrics.topic.partitionProduceRate,
+		"consume rate": e.metrics.group.consumeRate,
+		"catch-up":     e.metrics.group.catchUp,
+	} {
+		if n := testutil.CollectAndCount(collector); n != 1 {
+			t.Errorf("expected a single %s series left, got %d", name, n)
+		}
+	}
+	if len(e.rates.produce) != 1 || len(e.rates.consume) != 1 {
+		t.Error("expected the averages of the swept partitions to be forgotten")
+	}
+	if testutil.ToFloat64(e.metrics.group.catchUp.WithLabelValues("shipping")) != 1 {
+		t.Error("expected the catch-up of shipping to be kept")
+	}
+
+	// produce rates are kept when the end offsets couldn't be listed
+	observe(start.Add(3*time.Second), nil, []lagKey{shipping0})
+	e.sweepRates(false)
+	if n := testutil.CollectAndCount(e.metrics.topic.partitionProduceRate); n != 1 {
+		t.Error("expected the produce rate to be kept, got", n)
+	}
+	// the rates of a group that couldn't be fetched are kept until it recovers
+	e.keepConsumeRates("shipping")
+	e.sweepRates(true)
+	if _, ok := e.rates.consume[shipping0]; !ok {
+		t.Error("expected the consume rate of a failed group to be kept")
+	}
+	if testutil.ToFloat64(e.metrics.group.catchUp.WithLabelValues("shipping")) != 1 {
+		t.Error("expected the catch-up of a failed group to be kept")
+	}
+
+	// a cycle that ends before sweeping doesn't carry what it observed over
+	observe(start.Add(4*time.Second), []partitionKey{payments}, []lagKey{billing})
+	e.rates.clearSeen()
+	e.sweepRates(true)
+	if _, ok := e.rates.consume[billing]; ok {
+		t.Error("expected the consume rate observed by an unswept cycle to be forgotten")
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/remotewrite"
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// remoteWriter pushes the metrics to remote write endpoints after every export
+// cycle, for clusters Prometheus can't scrape. Every endpoint has its own
+// bounded queue, so that a slow one doesn't hold the others back.
+type remoteWriter struct {
+	config  RemoteWrite
+	metrics remoteWriteMetrics
+	queues  []remoteWriteQueue
+}
+
+type remoteWriteQueue struct {
+	client   *remotewrite.Client
+	requests chan []byte
+}
+
+func newRemoteWriter(conf RemoteWrite, metrics remoteWriteMetrics) *remoteWriter {
+	w := &remoteWriter{config: conf, metrics: metrics}
+	for _, url := range conf.URLs {
+		w.queues = append(w.queues, remoteWriteQueue{
+			client: &remotewrite.Client{
+				URL:         url,
+				Username:    conf.Username,
+				Password:    conf.Password,
+				BearerToken: conf.BearerToken,
+				HTTP:        &http.Client{Timeout: conf.Timeout},
+			},
+			requests: make(chan []byte, max(conf.QueueSize, 1)),
+		})
+	}
+	return w
+}
+
+func (*remoteWriter) Name() string { return "remote_write" }
+
+// Write queues the samples for every endpoint. The request is dropped for the
+// endpoints whose queue is full rather than blocking the export cycle.
+func (w *remoteWriter) Write(_ context.Context, samples []sink.Sample, at time.Time) error {
+	request := remotewrite.Encode(samples, at)
+
+	for _, q := range w.queues {
+		labels := prometheus.Labels{"url": q.client.URL}
+		select {
+		case q.requests <- request:
+		default:
+			log.Warn().Str("url", q.client.URL).Msg("remote write queue is full, dropping metrics")
+			w.metrics.dropped.With(labels).Inc()
+		}
+		w.metrics.queueLength.With(labels).Set(float64(len(q.requests)))
+	}
+	return nil
+}
+
+// run sends the queued requests until ctx is done.
+func (w *remoteWriter) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, q := range w.queues {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.drain(ctx, q)
+		}()
+	}
+	wg.Wait()
+}
+
+func (w *remoteWriter) drain(ctx context.Context, q remoteWriteQueue) {
+	labels := prometheus.Labels{"url": q.client.URL}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case request := <-q.requests:
+			w.metrics.queueLength.With(labels).Set(float64(len(q.requests)))
+			w.send(ctx, q.client, request)
+		}
+	}
+}
+
+// send sends a request, retrying recoverable failures with an exponential
+// backoff.
+func (w *remoteWriter) send(ctx context.Context, client *remotewrite.Client, request []byte) {
+	labels := prometheus.Labels{"url": client.URL}
+	backoff := w.config.MinBackoff
+
+	for attempt := 0; ; attempt++ {
+		start := time.Now()
+		err := client.Send(ctx, request)
+		w.metrics.duration.With(labels).Observe(time.Since(start).Seconds())
+
+		if err == nil {
+			w.metrics.sent.With(labels).Inc()
+			return
+		}
+
+		if !remotewrite.Recoverable(err) || attempt >= w.config.MaxRetries {
+			log.Error().Err(err).Str("url", client.URL).Int("attempts", attempt+1).Msg("failed to remote write metrics")
+			w.metrics.failures.With(labels).Inc()
+			return
+		}
+
+		log.Warn().Err(err).Str("url", client.URL).Dur("backoff", backoff).Msg("failed to remote write metrics, retrying")
+		w.metrics.retries.With(labels).Inc()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, w.config.MaxBackoff)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRemoteWrite(t *testing.T) {
+	var (
+		requests atomic.Int32
+		bodies   = make(chan []byte, 1)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			t.Error("unexpected authorization header", r.Header.Get("Authorization"))
+		}
+		if r.Header.Get("Content-Encoding") != "snappy" {
+			t.Error("unexpected content encoding", r.Header.Get("Content-Encoding"))
+		}
+
+		// the first request fails and is retried
+		if requests.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		compressed, _ := io.ReadAll(r.Body)
+		body, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			t.Error(err, "failed to decode request")
+		}
+		bodies <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	reg := prometheus.NewRegistry()
+	metrics := newMetrics(reg, Metrics{})
+	metrics.cluster.info.With(prometheus.Labels{"cluster_id": "test", "controller": "1", "metadata_version": ""}).Set(1)
+
+	w := newRemoteWriter(RemoteWrite{
+		URLs:        []string{server.URL},
+		BearerToken: "token",
+		Timeout:     time.Second,
+		QueueSize:   1,
+		MaxRetries:  1,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  time.Millisecond,
+	}, metrics.remoteWrite)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.run(ctx)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err, "failed to gather metrics")
+	}
+	if err := w.Write(ctx, sink.Flatten(families), time.Now()); err != nil {
+		t.Fatal(err, "failed to queue metrics")
+	}
+
+	select {
+	case body := <-bodies:
+		for _, s := range []string{"__name__", "kafka_cluster_info", "cluster_id", "test"} {
+			if !bytes.Contains(body, []byte(s)) {
+				t.Errorf("expected %q in the request", s)
+			}
+		}
+		if bytes.Contains(body, []byte("metadata_version")) {
+			t.Error("expected labels with empty values to be left out of the request")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the remote write request")
+	}
+
+	labels := prometheus.Labels{"url": server.URL}
+	if got := testutil.ToFloat64(metrics.remoteWrite.retries.With(labels)); got != 1 {
+		t.Error("expected 1 retry, got", got)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sinkQueue writes the metrics of every export cycle to a sink in the
+// background, so that a slow or unreachable sink delays neither the export
+// cycles nor the other sinks.
+type sinkQueue struct {
+	sink    sink.Sink
+	timeout time.Duration
+	metrics sinkMetrics
+
+	// writes holds the metrics of the cycle waiting for the sink to be done
+	// with the previous one
+	writes chan sinkWrite
+	// done is closed once run returned
+	done chan struct{}
+}
+
+type sinkWrite struct {
+	samples []sink.Sample
+	at      time.Time
+}
+
+func newSinkQueue(s sink.Sink, timeout time.Duration, metrics sinkMetrics) *sinkQueue {
+	return &sinkQueue{
+		sink:    s,
+		timeout: timeout,
+		metrics: metrics,
+		writes:  make(chan sinkWrite, 1),
+		done:    make(chan struct{}),
+	}
+}
+
+// enqueue queues the metrics of an export cycle, dropping them if the sink is
+// still busy with an earlier one.
+func (q *sinkQueue) enqueue(samples []sink.Sample, at time.Time) {
+	select {
+	case q.writes <- sinkWrite{samples: samples, at: at}:
+	default:
+		log.Warn().Str("sink", q.sink.Name()).Msg("sink is still writing earlier metrics, dropping metrics")
+		q.metrics.dropped.With(prometheus.Labels{"sink": q.sink.Name()}).Inc()
+	}
+}
+
+// run writes the queued metrics until ctx is done. A write in flight when ctx
+// is done still runs to completion, bounded by the timeout.
+func (q *sinkQueue) run(ctx context.Context) {
+	defer close(q.done)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case w := <-q.writes:
+			q.write(context.Background(), w)
+		}
+	}
+}
+
+// close waits for run to return and closes the sink if it holds on to
+// anything, e.g. the client of the publisher.
+func (q *sinkQueue) close() {
+	<-q.done
+
+	if c, ok := q.sink.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Error().Err(err).Str("sink", q.sink.Name()).Msg("failed to close sink")
+		}
+	}
+}
+
+func (q *sinkQueue) write(ctx context.Context, w sinkWrite) {
+	ctx, cancel := context.WithTimeout(ctx, q.timeout)
+	defer cancel()
+
+	if err := q.sink.Write(ctx, w.samples, w.at); err != nil {
+		log.Error().Err(err).Str("sink", q.sink.Name()).Msg("failed to write metrics to sink")
+		q.metrics.failures.With(prometheus.Labels{"sink": q.sink.Name()}).Inc()
+	}
+}
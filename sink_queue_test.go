@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/0xgirish/kafka-exporter/pkg/sink"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// blockingSink blocks every write until its context is done.
+type blockingSink struct{ writes chan struct{} }
+
+func (blockingSink) Name() string { return "blocking" }
+
+func (s blockingSink) Write(ctx context.Context, _ []sink.Sample, _ time.Time) error {
+	s.writes <- struct{}{}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// recordingSink records the time of every write.
+type recordingSink struct{ writes chan time.Time }
+
+func (recordingSink) Name() string { return "recording" }
+
+func (s recordingSink) Write(_ context.Context, _ []sink.Sample, at time.Time) error {
+	s.writes <- at
+	return nil
+}
+
+func TestSinkQueues(t *testing.T) {
+	metrics := newMetrics(prometheus.NewRegistry(), Metrics{})
+	blocking := blockingSink{writes: make(chan struct{}, 10)}
+	recording := recordingSink{writes: make(chan time.Time, 10)}
+
+	e := &exporter{
+		metrics: metrics,
+		sinks: []*sinkQueue{
+			newSinkQueue(blocking, time.Hour, metrics.sink),
+			newSinkQueue(recording, time.Hour, metrics.sink),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for _, q := range e.sinks {
+		go q.run(ctx)
+	}
+
+	// the blocking sink takes the first cycle, queues the second and drops
+	// the third, without holding up the other sink
+	for cycle := 0; cycle < 3; cycle++ {
+		e.writeSinks()
+		select {
+		case <-recording.writes:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the other sink to be written to")
+		}
+		if cycle == 0 {
+			<-blocking.writes
+		}
+	}
+
+	labels := prometheus.Labels{"sink": "blocking"}
+	if got := testutil.ToFloat64(metrics.sink.dropped.With(labels)); got != 1 {
+		t.Error("expected 1 dropped cycle, got", got)
+	}
+}
+
+func TestSinkQueueTimeout(t *testing.T) {
+	metrics := newMetrics(prometheus.NewRegistry(), Metrics{})
+	blocking := blockingSink{writes: make(chan struct{}, 1)}
+
+	q := newSinkQueue(blocking, 10*time.Millisecond, metrics.sink)
+	q.write(context.Background(), sinkWrite{at: time.Now()})
+
+	if got := testutil.ToFloat64(metrics.sink.failures.With(prometheus.Labels{"sink": "blocking"})); got != 1 {
+		t.Error("expected the timed out write to fail, got", got)
+	}
+}
+
+// closingSink holds every write until it is released and records whether it
+// was closed.
+type closingSink struct {
+	writes   chan struct{}
+	release  chan struct{}
+	canceled chan bool
+	closed   chan struct{}
+}
+
+func (closingSink) Name() string { return "closing" }
+
+func (s closingSink) Write(ctx context.Context, _ []sink.Sample, _ time.Time) error {
+	s.writes <- struct{}{}
+	<-s.release
+	s.canceled <- ctx.Err() != nil
+	return nil
+}
+
+func (s closingSink) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestSinkQueueClose(t *testing.T) {
+	metrics := newMetrics(prometheus.NewRegistry(), Metrics{})
+	closing := closingSink{
+		writes:   make(chan struct{}, 1),
+		release:  make(chan struct{}),
+		canceled: make(chan bool, 1),
+		closed:   make(chan struct{}),
+	}
+
+	q := newSinkQueue(closing, time.Hour, metrics.sink)
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.run(ctx)
+
+	q.enqueue(nil, time.Now())
+	<-closing.writes
+	cancel()
+
+	closed := make(chan struct{})
+	go func() {
+		q.close()
+		close(closed)
+	}()
+
+	// the sink isn't closed while a write is still in flight
+	select {
+	case <-closing.closed:
+		t.Fatal("expected the sink to be closed after the write in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(closing.release)
+	if <-closing.canceled {
+		t.Error("expected the write in flight to run to completion")
+	}
+
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the queue to close")
+	}
+	select {
+	case <-closing.closed:
+	default:
+		t.Error("expected the sink to be closed")
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/0xgirish/kafka-exporter/pkg/lagstatus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// evaluateStatus adds the sample to the sliding window of the group on the
+// partition, carrying the window over from the previous export cycle, and
+// exports the resulting status.
+func (e *exporter) evaluateStatus(windows map[lagKey]*lagstatus.Window, key lagKey, sample lagstatus.Sample) lagstatus.Status {
+	window, ok := e.windows[key]
+	if !ok {
+		window = &lagstatus.Window{Size: e.config.LagStatus.WindowSize}
+	}
+
+	window.Add(sample)
+	windows[key] = window
+
+	status := window.Evaluate(lagstatus.Thresholds{
+		WarningLag: e.config.LagStatus.WarningLag,
+		ErrorLag:   e.config.LagStatus.ErrorLag,
+	})
+
+	e.metrics.group.partitionStatus.With(prometheus.Labels{
+		"consumergroup": key.group,
+		"topic":         key.topic,
+		"partition":     strconv.Itoa(int(key.partition)),
+	}).Set(float64(status))
+
+	return status
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/0xgirish/kafka-exporter/pkg/lagstatus"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestEvaluateStatus(t *testing.T) {
+	conf := Config{LagStatus: LagStatus{WindowSize: 3, ErrorLag: 1000}}
+
+	tests := []struct {
+		name    string
+		samples []lagstatus.Sample
+		want    lagstatus.Status
+	}{
+		{
+			name:    "caught up",
+			samples: []lagstatus.Sample{{Offset: 10, Lag: 5}, {Offset: 20, Lag: 5}, {Offset: 30, Lag: 0}},
+			want:    lagstatus.OK,
+		},
+		{
+			name:    "window not full yet",
+			samples: []lagstatus.Sample{{Offset: 10, Lag: 5}, {Offset: 10, Lag: 6}},
+			want:    lagstatus.OK,
+		},
+		{
+			name:    "falling behind",
+			samples: []lagstatus.Sample{{Offset: 10, Lag: 5}, {Offset: 20, Lag: 6}, {Offset: 30, Lag: 7}},
+			want:    lagstatus.Warning,
+		},
+		{
+			name:    "above error threshold",
+			samples: []lagstatus.Sample{{Offset: 10, Lag: 2000}},
+			want:    lagstatus.Error,
+		},
+		{
+			name:    "nobody consuming",
+			samples: []lagstatus.Sample{{Offset: 10, Lag: 5}, {Offset: 10, Lag: 5}, {Offset: 10, Lag: 6}},
+			want:    lagstatus.Stop,
+		},
+		{
+			name: "member stuck on the same offset",
+			samples: []lagstatus.Sample{
+				{Offset: 10, Lag: 5, Active: true},
+				{Offset: 10, Lag: 5, Active: true},
+				{Offset: 10, Lag: 5, Active: true},
+			},
+			want: lagstatus.Stall,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := &exporter{config: conf, metrics: newMetrics(prometheus.NewRegistry(), Metrics{})}
+			key := lagKey{group: "dummy-cg", topic: "topic1", partition: 0}
+
+			var status lagstatus.Status
+			for _, sample := range tt.samples {
+				windows := make(map[lagKey]*lagstatus.Window)
+				status = e.evaluateStatus(windows, key, sample)
+				e.windows = windows
+			}
+
+			if status != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, status)
+			}
+		})
+	}
+}
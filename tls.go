@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// certificateObserver is called with the certificate chain every broker
+// presents when connecting, along with the error verifying it, if any.
+type certificateObserver func(address string, chain []*x509.Certificate, verifyErr error)
+
+// dialTLS returns a dial function connecting to the brokers over TLS. The
+// chain presented by the brokers is verified by hand rather than by the
+// handshake, so that it can be observed even when it doesn't verify, or when
+// verification is skipped.
+func dialTLS(conf TLS, observe certificateObserver) func(ctx context.Context, network, address string) (net.Conn, error) {
+	// same as kgo's default dial timeout
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		config := &tls.Config{
+			ServerName:         host,
+			InsecureSkipVerify: true,
+			VerifyConnection: func(cs tls.ConnectionState) error {
+				err := verifyChain(cs)
+				if observe != nil {
+					observe(address, cs.PeerCertificates, err)
+				}
+
+				if conf.InsecureSkipTLSVerify {
+					return nil
+				}
+				return err
+			},
+		}
+
+		return (&tls.Dialer{NetDialer: dialer, Config: config}).DialContext(ctx, network, address)
+	}
+}
+
+// verifyChain verifies the chain presented by a broker against the system
+// roots, the way the handshake does unless verification is skipped.
+func verifyChain(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("broker presented no certificate")
+	}
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// observeCertificates exports the expiry of every certificate of the chain a
+// broker presented and whether the chain verified.
+func (h *clientHooks) observeCertificates(address string, chain []*x509.Certificate, verifyErr error) {
+	// the broker may have rotated its certificates since it was last seen
+	h.metrics.certNotAfter.DeletePartialMatch(prometheus.Labels{"broker": address})
+	for _, cert := range chain {
+		h.metrics.certNotAfter.With(prometheus.Labels{
+			"broker":  address,
+			"subject": cert.Subject.String(),
+			"issuer":  cert.Issuer.String(),
+		}).Set(float64(cert.NotAfter.Unix()))
+	}
+
+	failed := 0
+	if verifyErr != nil {
+		failed = 1
+	}
+	h.metrics.certVerificationFailed.With(prometheus.Labels{"broker": address}).Set(float64(failed))
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/twmb/franz-go/pkg/kfake"
+)
+
+func TestCertificateMetrics(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err, "failed to generate key")
+	}
+
+	notAfter := time.Now().Add(time.Hour).Truncate(time.Second)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "kfake"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err, "failed to create certificate")
+	}
+
+	_, conf := newTestCluster(t, kfake.NumBrokers(1), kfake.TLS(&tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+	}))
+
+	// the self signed certificate doesn't verify, so only an exporter
+	// skipping verification can connect
+	conf.Kafka.TLS = TLS{Enabled: true, InsecureSkipTLSVerify: true}
+
+	e := NewExporter(conf)
+	defer e.client.Close()
+
+	broker := string(conf.Kafka.Servers[0])
+	labels := prometheus.Labels{"broker": broker, "subject": "CN=kfake", "issuer": "CN=kfake"}
+	if got := testutil.ToFloat64(e.metrics.client.certNotAfter.With(labels)); got != float64(notAfter.Unix()) {
+		t.Fatalf("expected certificate to expire at %d, got %v", notAfter.Unix(), got)
+	}
+
+	if got := testutil.ToFloat64(e.metrics.client.certVerificationFailed.With(prometheus.Labels{"broker": broker})); got != 1 {
+		t.Fatal("expected certificate verification to fail, got", got)
+	}
+
+	var observed bool
+	dial := dialTLS(TLS{Enabled: true}, func(string, []*x509.Certificate, error) { observed = true })
+	if _, err := dial(context.Background(), "tcp", broker); err == nil {
+		t.Fatal("expected dialing to fail verification")
+	}
+	if !observed {
+		t.Fatal("expected certificates to be observed even though they don't verify")
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/phuslu/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/twmb/franz-go/pkg/kadm"
+)
+
+// openTransactionStates are the states of a transaction that still holds back
+// the last stable offset of the partitions it wrote to.
+var openTransactionStates = []string{"Ongoing", "PrepareCommit", "PrepareAbort", "PrepareEpochFence"}
+
+// partitionTransactions is the transactional state of a partition, as seen by
+// its leader.
+type partitionTransactions struct {
+	activeProducers int
+	open            int
+	oldestOpen      time.Duration
+	hanging         int
+}
+
+// describePartitionTransactions derives the transactional state of every
+// partition from its producers. A producer with a current transaction start
+// offset has a transaction open on the partition, even when its coordinator
+// has already forgotten about it (KIP-664). The age of such a transaction is
+// taken from the coordinator's start timestamp when known, and otherwise from
+// the last time the producer wrote to the partition, which is a lower bound.
+func describePartitionTransactions(producers kadm.DescribedProducersTopics, started map[int64]time.Time, threshold time.Duration, now time.Time) map[partitionKey]partitionTransactions {
+	described := make(map[partitionKey]partitionTransactions)
+	for _, topic := range producers {
+		for _, partition := range topic.Partitions {
+			if partition.Err != nil {
+				continue
+			}
+
+			state := partitionTransactions{activeProducers: len(partition.ActiveProducers)}
+			for _, producer := range partition.ActiveProducers {
+				if producer.CurrentTxnStartOffset < 0 {
+					continue
+				}
+				state.open++
+
+				start, ok := started[producer.ProducerID]
+				if last := time.UnixMilli(producer.LastTimestamp); producer.LastTimestamp >= 0 && (!ok || last.Before(start)) {
+					start, ok = last, true
+				}
+				if !ok {
+					continue
+				}
+
+				age := now.Sub(start)
+				state.oldestOpen = max(state.oldestOpen, age)
+				if age > threshold {
+					state.hanging++
+				}
+			}
+			described[partitionKey{topic: partition.Topic, partition: partition.Partition}] = state
+		}
+	}
+	return described
+}
+
+// exportTransactions exports the active producers and open transactions of
+// every partition and the state of every transaction. Open transactions hold
+// back the last stable offset, so a hanging one stalls every read_committed
+// consumer.
+func (e *exporter) exportTransactions(ctx context.Context, metadata kadm.Metadata) error {
+	transactions, err := e.client.DescribeTransactions(ctx)
+	switch {
+	case err == nil:
+	case unsupported(err):
+		log.Debug().Err(err).Msg("cluster does not support describe transactions, skipping transaction metrics")
+	case partialFailure(err):
+		log.Error().Err(err).Msg("failed to describe some transactions")
+		e.onErrors.Record(err)
+	default:
+		return err
+	}
+
+	now := time.Now()
+	states := make(map[string]int)
+	started := make(map[int64]time.Time)
+
+	e.metrics.transaction.states.Reset()
+	e.metrics.transaction.openAge.Reset()
+	e.metrics.transaction.hanging.Reset()
+
+	for _, txn := range transactions.Sorted() {
+		if txn.Err != nil {
+			log.Error().Err(txn.Err).Str("transactional_id", txn.TxnID).Msg("failed to describe transaction")
+			e.onErrors.Record(txn.Err)
+			continue
+		}
+
+		states[txn.State]++
+		if !slices.Contains(openTransactionStates, txn.State) || txn.StartTimestamp < 0 {
+			continue
+		}
+
+		started[txn.ProducerID] = time.UnixMilli(txn.StartTimestamp)
+		age := now.Sub(started[txn.ProducerID])
+		labels := prometheus.Labels{"transactional_id": txn.TxnID}
+
+		e.metrics.transaction.openAge.With(labels).Set(age.Seconds())
+
+		hanging := 0
+		if age > e.config.Transactions.HangingThreshold {
+			hanging = 1
+			log.Warn().
+				Str("transactional_id", txn.TxnID).
+				Int64("producer_id", txn.ProducerID).
+				Str("state", txn.State).
+				Dur("age", age).
+				Msg("transaction open for longer than the hanging threshold")
+		}
+		e.metrics.transaction.hanging.With(labels).Set(float64(hanging))
+	}
+
+	for state, count := range states {
+		e.metrics.transaction.states.With(prometheus.Labels{"state": state}).Set(float64(count))
+	}
+
+	producers, err := e.client.DescribeProducers(ctx, metadata.Topics.TopicsSet())
+	switch {
+	case err == nil:
+	case unsupported(err):
+		log.Debug().Err(err).Msg("cluster does not support describe producers, skipping producer metrics")
+	case partialFailure(err):
+		log.Error().Err(err).Msg("failed to describe producers of some partitions")
+		e.onErrors.Record(err)
+	default:
+		return err
+	}
+
+	for _, topic := range producers {
+		for _, partition := range topic.Partitions {
+			if partition.Err != nil {
+				log.Error().Err(partition.Err).Str("topic", partition.Topic).Int32("partition", partition.Partition).Msg("failed to describe partition producers")
+				e.onErrors.Record(partition.Err)
+			}
+		}
+	}
+
+	e.metrics.transaction.activeProducers.Reset()
+	e.metrics.transaction.partitionOldestOpenAge.Reset()
+	e.metrics.transaction.partitionHanging.Reset()
+
+	for key, state := range describePartitionTransactions(producers, started, e.config.Transactions.HangingThreshold, now) {
+		labels := prometheus.Labels{
+			"topic":     key.topic,
+			"partition": strconv.Itoa(int(key.partition)),
+		}
+		e.metrics.transaction.activeProducers.With(labels).Set(float64(state.activeProducers))
+		if state.open == 0 {
+			continue
+		}
+
+		e.metrics.transaction.partitionOldestOpenAge.With(labels).Set(state.oldestOpen.Seconds())
+		e.metrics.transaction.partitionHanging.With(labels).Set(float64(state.hanging))
+		if state.hanging > 0 {
+			log.Warn().
+				Str("topic", key.topic).
+				Int32("partition", key.partition).
+				Int("transactions", state.hanging).
+				Msg("partition has transactions open for longer than the hanging threshold")
+		}
+	}
+
+	return nil
+}
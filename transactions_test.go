@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kadm"
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+func TestDescribePartitionTransactions(t *testing.T) {
+	now := time.UnixMilli(1_700_000_000_000)
+	ago := func(d time.Duration) int64 { return now.Add(-d).UnixMilli() }
+
+	producers := func(partitions ...kadm.DescribedProducersPartition) kadm.DescribedProducersTopics {
+		topic := kadm.DescribedProducersTopic{Topic: "orders", Partitions: make(kadm.DescribedProducersPartitions)}
+		for _, partition := range partitions {
+			partition.Topic = "orders"
+			topic.Partitions[partition.Partition] = partition
+		}
+		return kadm.DescribedProducersTopics{"orders": topic}
+	}
+	producer := func(id int64, txnStart int64, last int64) kadm.DescribedProducer {
+		return kadm.DescribedProducer{ProducerID: id, CurrentTxnStartOffset: txnStart, LastTimestamp: last}
+	}
+
+	for _, tc := range []struct {
+		name      string
+		producers kadm.DescribedProducersTopics
+		started   map[int64]time.Time
+		expected  map[partitionKey]partitionTransactions
+	}{
+		{
+			name: "idempotent producers have no open transaction",
+			producers: producers(kadm.DescribedProducersPartition{Partition: 0, ActiveProducers: kadm.DescribedProducers{
+				1: producer(1, -1, ago(time.Hour)),
+				2: producer(2, -1, ago(time.Hour)),
+			}}),
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 0}: {activeProducers: 2},
+			},
+		},
+		{
+			name: "open transaction within the threshold",
+			producers: producers(kadm.DescribedProducersPartition{Partition: 0, ActiveProducers: kadm.DescribedProducers{
+				1: producer(1, 10, ago(time.Minute)),
+			}}),
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 0}: {activeProducers: 1, open: 1, oldestOpen: time.Minute},
+			},
+		},
+		{
+			name: "transaction unknown to its coordinator hangs past the threshold",
+			producers: producers(kadm.DescribedProducersPartition{Partition: 0, ActiveProducers: kadm.DescribedProducers{
+				1: producer(1, 10, ago(time.Minute)),
+				2: producer(2, 20, ago(20*time.Minute)),
+			}}),
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 0}: {activeProducers: 2, open: 2, oldestOpen: 20 * time.Minute, hanging: 1},
+			},
+		},
+		{
+			name: "the coordinator's start timestamp is preferred over the last write",
+			producers: producers(kadm.DescribedProducersPartition{Partition: 0, ActiveProducers: kadm.DescribedProducers{
+				1: producer(1, 10, ago(time.Minute)),
+			}}),
+			started: map[int64]time.Time{1: now.Add(-30 * time.Minute)},
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 0}: {activeProducers: 1, open: 1, oldestOpen: 30 * time.Minute, hanging: 1},
+			},
+		},
+		{
+			name: "open transaction without any timestamp has no age",
+			producers: producers(kadm.DescribedProducersPartition{Partition: 0, ActiveProducers: kadm.DescribedProducers{
+				1: producer(1, 10, -1),
+			}}),
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 0}: {activeProducers: 1, open: 1},
+			},
+		},
+		{
+			name: "failed partitions are skipped",
+			producers: producers(
+				kadm.DescribedProducersPartition{Partition: 0, Err: kerr.NotLeaderForPartition},
+				kadm.DescribedProducersPartition{Partition: 1},
+			),
+			expected: map[partitionKey]partitionTransactions{
+				{topic: "orders", partition: 1}: {},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := describePartitionTransactions(tc.producers, tc.started, 10*time.Minute, now)
+			if !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("expected %+v, got %+v", tc.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"cmp"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/phuslu/log"
+)
+
+//go:embed ui/index.html
+var uiTemplate string
+
+// lagHistory keeps the total lag of every consumer group over the most recent
+// export cycles for the sparklines of the UI.
+type lagHistory struct {
+	mu     sync.Mutex
+	size   int
+	groups map[string]*lagRing
+}
+
+// lagRing is a fixed size ring buffer of lag samples.
+type lagRing struct {
+	values []int64
+	next   int
+	full   bool
+}
+
+func newLagHistory(size int) *lagHistory {
+	return &lagHistory{size: max(size, 2), groups: make(map[string]*lagRing)}
+}
+
+// record adds the lag of every group of the snapshot, forgetting the groups
+// that are gone.
+func (h *lagHistory) record(groups map[string]groupSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for name := range h.groups {
+		if _, ok := groups[name]; !ok {
+			delete(h.groups, name)
+		}
+	}
+
+	for name, group := range groups {
+		r, ok := h.groups[name]
+		if !ok {
+			r = &lagRing{values: make([]int64, h.size)}
+			h.groups[name] = r
+		}
+
+		r.values[r.next] = group.Lag
+		r.next = (r.next + 1) % len(r.values)
+		r.full = r.full || r.next == 0
+	}
+}
+
+// lags returns the recorded lag of the group, oldest first.
+func (h *lagHistory) lags(group string) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	r, ok := h.groups[group]
+	if !ok {
+		return nil
+	}
+	if !r.full {
+		return slices.Clone(r.values[:r.next])
+	}
+	return append(slices.Clone(r.values[r.next:]), r.values[:r.next]...)
+}
+
+// sparkline returns the points of an SVG polyline of the lags in a 100x20 box.
+func sparkline(lags []int64) string {
+	if len(lags) < 2 {
+		return ""
+	}
+
+	high := max(slices.Max(lags), 1)
+	points := make([]string, 0, len(lags))
+	for i, lag := range lags {
+		x := float64(i) * 100 / float64(len(lags)-1)
+		y := 20 - float64(lag)*20/float64(high)
+		points = append(points, fmt.Sprintf("%.1f,%.1f", x, y))
+	}
+	return strings.Join(points, " ")
+}
+
+type uiGroup struct {
+	groupSnapshot
+	Sparkline string
+}
+
+type uiPage struct {
+	Cluster clusterSnapshot
+	Topics  []topicSnapshot
+	Groups  []uiGroup
+	Refresh int
+}
+
+// uiHandler serves a dashboard of the latest snapshot. It has no external
+// assets, so that it works without internet access.
+func (e *exporter) uiHandler() http.Handler {
+	page := template.Must(template.New("ui").Parse(uiTemplate))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s := e.snapshot.Load()
+		if s == nil {
+			http.Error(w, "no export cycle completed yet", http.StatusServiceUnavailable)
+			return
+		}
+
+		data := uiPage{
+			Cluster: s.cluster,
+			Topics:  sortedValues(s.topics),
+			Refresh: int(max(e.config.RefreshInterval, time.Second).Seconds()),
+		}
+
+		for _, group := range sortedValues(s.groups) {
+			data.Groups = append(data.Groups, uiGroup{
+				groupSnapshot: group,
+				Sparkline:     sparkline(e.history.lags(group.Name)),
+			})
+		}
+		// the most lagging groups are the ones of interest during incidents
+		slices.SortStableFunc(data.Groups, func(a, b uiGroup) int {
+			return cmp.Compare(b.Lag, a.Lag)
+		})
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := page.Execute(w, data); err != nil {
+			log.Debug().Err(err).Msg("failed to render ui")
+		}
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLagHistory(t *testing.T) {
+	h := newLagHistory(3)
+	for _, lag := range []int64{1, 2, 3, 4} {
+		h.record(map[string]groupSnapshot{"billing": {Name: "billing", Lag: lag}})
+	}
+
+	if got := h.lags("billing"); !reflect.DeepEqual(got, []int64{2, 3, 4}) {
+		t.Error("expected the 3 most recent lags oldest first, got", got)
+	}
+
+	h.record(map[string]groupSnapshot{"shipping": {Name: "shipping", Lag: 1}})
+	if got := h.lags("billing"); got != nil {
+		t.Error("expected the history of a gone group to be forgotten, got", got)
+	}
+	if got := h.lags("shipping"); !reflect.DeepEqual(got, []int64{1}) {
+		t.Error("expected a single lag, got", got)
+	}
+}
+
+func TestLagHistoryCarriedOverGroups(t *testing.T) {
+	e := &exporter{history: newLagHistory(10)}
+
+	e.storeSnapshot(&snapshot{groups: map[string]groupSnapshot{"billing": {Name: "billing", Lag: 10}}})
+	// a cycle that didn't export the groups serves the previous ones
+	e.storeSnapshot(&snapshot{})
+
+	if got := e.snapshot.Load().groups; len(got) != 1 {
+		t.Error("expected the groups of the previous cycle to be served, got", got)
+	}
+	if got := e.history.lags("billing"); !reflect.DeepEqual(got, []int64{10}) {
+		t.Error("expected only the cycle exporting the groups in the history, got", got)
+	}
+}
+
+func TestUI(t *testing.T) {
+	e := &exporter{config: Config{RefreshInterval: 30 * time.Second}, history: newLagHistory(10)}
+
+	w := httptest.NewRecorder()
+	e.uiHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Error("expected 503 before the first export cycle, got", w.Code)
+	}
+
+	offset := int64(42)
+	for _, lag := range []int64{10, 5} {
+		e.storeSnapshot(&snapshot{
+			cluster: clusterSnapshot{ID: "kfake", Controller: 1, Brokers: []brokerSnapshot{{ID: 1, Host: "localhost", Port: 9092}}},
+			topics: map[string]topicSnapshot{"orders": {Name: "orders", Partitions: []partitionSnapshot{
+				{Partition: 0, Leader: 1, Replicas: []int32{1, 2}, ISR: []int32{1}, EndOffset: &offset},
+			}}},
+			groups: map[string]groupSnapshot{
+				"billing":  {Name: "billing", Status: "OK", Lag: lag},
+				"shipping": {Name: "shipping", Status: "ERROR", Lag: 100},
+			},
+		})
+	}
+
+	w = httptest.NewRecorder()
+	e.uiHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ui", nil))
+	body := w.Body.String()
+
+	for _, s := range []string{"localhost:9092", "orders", "<polyline", `class="ERROR">[1]`, ">42<"} {
+		if !strings.Contains(body, s) {
+			t.Errorf("expected %q in the page", s)
+		}
+	}
+	if strings.Index(body, "shipping") > strings.Index(body, "billing") {
+		t.Error("expected groups sorted by descending lag")
+	}
+	if strings.Contains(body, "http://") || strings.Contains(body, "https://") {
+		t.Error("expected no external assets")
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gopkg.in/yaml.v3"
+)
+
+// healthPath is served without authentication, for liveness probes.
+const healthPath = "/-/healthy"
+
+// webConfig protects the endpoints of the exporter, in the format of the
+// Prometheus exporter-toolkit web configuration file plus static bearer
+// tokens.
+type webConfig struct {
+	TLSServerConfig *webTLSConfig `yaml:"tls_server_config"`
+	// BasicAuthUsers maps usernames to bcrypt hashed passwords
+	BasicAuthUsers map[string]string `yaml:"basic_auth_users"`
+	BearerTokens   []string          `yaml:"bearer_tokens"`
+}
+
+type webTLSConfig struct {
+	CertFile       string `yaml:"cert_file"`
+	KeyFile        string `yaml:"key_file"`
+	ClientAuthType string `yaml:"client_auth_type"`
+	ClientCAFile   string `yaml:"client_ca_file"`
+}
+
+func loadWebConfig(path string) (*webConfig, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config webConfig
+	if err := yaml.Unmarshal(b, &config); err != nil {
+		return nil, fmt.Errorf("invalid web config %s: %w", path, err)
+	}
+
+	for user, hash := range config.BasicAuthUsers {
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("invalid bcrypt hash of user %s: %w", user, err)
+		}
+	}
+
+	return &config, nil
+}
+
+var clientAuthTypes = map[string]tls.ClientAuthType{
+	"":                           tls.NoClientCert,
+	"NoClientCert":               tls.NoClientCert,
+	"RequestClientCert":          tls.RequestClientCert,
+	"RequireAnyClientCert":       tls.RequireAnyClientCert,
+	"VerifyClientCertIfGiven":    tls.VerifyClientCertIfGiven,
+	"RequireAndVerifyClientCert": tls.RequireAndVerifyClientCert,
+}
+
+// tlsConfig returns the TLS config of the server, nil if it serves plaintext.
+// The certificate and key are reloaded whenever they change on disk.
+func (c *webConfig) tlsConfig() (*tls.Config, error) {
+	if c.TLSServerConfig == nil {
+		return nil, nil
+	}
+	conf := c.TLSServerConfig
+
+	if conf.CertFile == "" || conf.KeyFile == "" {
+		return nil, errors.New("tls_server_config requires cert_file and key_file")
+	}
+
+	clientAuth, ok := clientAuthTypes[conf.ClientAuthType]
+	if !ok {
+		return nil, fmt.Errorf("invalid client_auth_type: %s", conf.ClientAuthType)
+	}
+
+	cert := &reloadingCertificate{certFile: conf.CertFile, keyFile: conf.KeyFile}
+	// fail on startup rather than on the first handshake
+	if _, err := cert.get(nil); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+		ClientAuth:     clientAuth,
+	}
+
+	if conf.ClientCAFile != "" {
+		pem, err := os.ReadFile(conf.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		config.ClientCAs = x509.NewCertPool()
+		if !config.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in client_ca_file %s", conf.ClientCAFile)
+		}
+	} else if clientAuth == tls.VerifyClientCertIfGiven || clientAuth == tls.RequireAndVerifyClientCert {
+		return nil, fmt.Errorf("client_auth_type %s requires client_ca_file", conf.ClientAuthType)
+	}
+
+	return config, nil
+}
+
+// reloadingCertificate loads the server certificate again whenever its files
+// are modified, so that rotated certificates are picked up without a restart.
+type reloadingCertificate struct {
+	certFile, keyFile string
+
+	mu       sync.Mutex
+	cert     *tls.Certificate
+	modTimes [2]time.Time
+}
+
+func (r *reloadingCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var modTimes [2]time.Time
+	for i, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cert != nil && modTimes == r.modTimes {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		// keep serving the previous certificate while the files are being
+		// replaced
+		if r.cert != nil {
+			return r.cert, nil
+		}
+		return nil, err
+	}
+
+	r.cert, r.modTimes = &cert, modTimes
+	return r.cert, nil
+}
+
+// protect requires the requests, except health checks, to authenticate with
+// one of the basic auth users or bearer tokens, if any is configured.
+func (c *webConfig) protect(next http.Handler) http.Handler {
+	if len(c.BasicAuthUsers) == 0 && len(c.BearerTokens) == 0 {
+		return next
+	}
+
+	// bcrypt is slow on purpose, don't pay for it on every scrape
+	var verified sync.Map
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == healthPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			for _, t := range c.BearerTokens {
+				if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		if user, password, ok := r.BasicAuth(); ok {
+			if hash, ok := c.BasicAuthUsers[user]; ok {
+				key := sha256.Sum256([]byte(hash + "\x00" + password))
+				if _, ok := verified.Load(key); ok {
+					next.ServeHTTP(w, r)
+					return
+				}
+
+				if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+					verified.Store(key, struct{}{})
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+		}
+
+		if len(c.BasicAuthUsers) > 0 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="kafka-exporter"`)
+		}
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+	})
+}
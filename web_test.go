@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestWebAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err, "failed to hash password")
+	}
+
+	web := &webConfig{
+		BasicAuthUsers: map[string]string{"prometheus": string(hash)},
+		BearerTokens:   []string{"token"},
+	}
+	handler := web.protect(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {}))
+
+	for _, tc := range []struct {
+		name string
+		path string
+		auth func(*http.Request)
+		code int
+	}{
+		{name: "no credentials", path: "/metrics", code: http.StatusUnauthorized},
+		{name: "health check", path: healthPath, code: http.StatusOK},
+		{name: "basic auth", path: "/metrics", auth: func(r *http.Request) { r.SetBasicAuth("prometheus", "secret") }, code: http.StatusOK},
+		{name: "wrong password", path: "/metrics", auth: func(r *http.Request) { r.SetBasicAuth("prometheus", "wrong") }, code: http.StatusUnauthorized},
+		{name: "unknown user", path: "/metrics", auth: func(r *http.Request) { r.SetBasicAuth("grafana", "secret") }, code: http.StatusUnauthorized},
+		{name: "bearer token", path: "/api/v1/groups", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }, code: http.StatusOK},
+		{name: "wrong bearer token", path: "/api/v1/groups", auth: func(r *http.Request) { r.Header.Set("Authorization", "Bearer wrong") }, code: http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.auth != nil {
+				tc.auth(r)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			if w.Code != tc.code {
+				t.Errorf("expected %d, got %d", tc.code, w.Code)
+			}
+		})
+	}
+}
+
+func TestWebCertificateReload(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+
+	writeCert := func(cn string, modTime time.Time) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err, "failed to generate key")
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: cn},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		if err != nil {
+			t.Fatal(err, "failed to create certificate")
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err, "failed to marshal key")
+		}
+
+		for path, block := range map[string]*pem.Block{
+			certFile: {Type: "CERTIFICATE", Bytes: der},
+			keyFile:  {Type: "EC PRIVATE KEY", Bytes: keyDER},
+		} {
+			if err := os.WriteFile(path, pem.EncodeToMemory(block), 0o600); err != nil {
+				t.Fatal(err, "failed to write", path)
+			}
+			if err := os.Chtimes(path, modTime, modTime); err != nil {
+				t.Fatal(err, "failed to touch", path)
+			}
+		}
+	}
+
+	writeCert("first", time.Now().Add(-time.Minute))
+	config, err := (&webConfig{TLSServerConfig: &webTLSConfig{CertFile: certFile, KeyFile: keyFile}}).tlsConfig()
+	if err != nil {
+		t.Fatal(err, "failed to create tls config")
+	}
+
+	commonName := func() string {
+		cert, err := config.GetCertificate(nil)
+		if err != nil {
+			t.Fatal(err, "failed to get certificate")
+		}
+		parsed, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			t.Fatal(err, "failed to parse certificate")
+		}
+		return parsed.Subject.CommonName
+	}
+
+	if cn := commonName(); cn != "first" {
+		t.Fatal("expected the first certificate, got", cn)
+	}
+
+	writeCert("second", time.Now())
+	if cn := commonName(); cn != "second" {
+		t.Fatal("expected the rotated certificate, got", cn)
+	}
+}